@@ -1,45 +1,140 @@
 package config
 
 import (
+	"time"
+
 	"github.com/kyaxcorp/go-helper/_struct"
 	loggerConfig "github.com/kyaxcorp/go-logger/config"
 )
 
+// Config -> the fields tagged with secret:"true" are redacted when the config is outputted (see Redact)
 type Config struct {
 	// Should be in this format: 192.168.0.1:8080, localhost:8080 etc.. 0.0.0.0:8080
-	IsEnabled   string `yaml:"is_enabled" mapstructure:"is_enabled" default:"yes"`
+	IsEnabled   Flag `yaml:"is_enabled" mapstructure:"is_enabled" default:"true"`
 	Name        string
 	Description string
 
 	// Enable server status which will give information about the server
-	EnableServerStatus string `yaml:"enable_server_status" mapstructure:"enable_server_status" default:"yes"`
-	// Credentials for Status Access
+	EnableServerStatus Flag `yaml:"enable_server_status" mapstructure:"enable_server_status" default:"true"`
+	// Credentials for Status Access, this account has the admin scope
+	// The password can be plain, bcrypt or argon2 (PHC format) hash
+	// The default password is refused, unless ServerStatusAllowInsecureDefaults is enabled
 	ServerStatusUsername string `yaml:"server_status_username" mapstructure:"server_status_username" default:"admin"`
-	ServerStatusPassword string `yaml:"server_status_password" mapstructure:"server_status_password" default:"admin_password"`
+	ServerStatusPassword string `yaml:"server_status_password" mapstructure:"server_status_password" default:"admin_password" secret:"true"`
+	// Additional accounts for Status Access, each one with its own scope (read_only or admin)
+	ServerStatusAccounts []StatusAccount `yaml:"server_status_accounts" mapstructure:"server_status_accounts"`
+	// Allows starting with the default status password... it's insecure, use it only for development!
+	ServerStatusAllowInsecureDefaults Flag `yaml:"server_status_allow_insecure_defaults" mapstructure:"server_status_allow_insecure_defaults" default:"false"`
 
 	//
-	EnableSSL string `yaml:"enable_ssl" mapstructure:"enable_ssl" default:"yes"`
+	EnableSSL Flag `yaml:"enable_ssl" mapstructure:"enable_ssl" default:"true"`
 	// This is the path where the ssl cert file is being read, if no path provided, then an autogenerated certificate
 	//will be made and used
 	SSLCertFilePath string `yaml:"ssl_cert_file_path" mapstructure:"ssl_cert_file_path"`
 	// This is the path where the ssl key file is being read, if no path provided, then an autogenerated certificate
 	//will be made and used
-	SSLKeyFilePath string `yaml:"ssl_key_file_path" mapstructure:"ssl_key_file_path"`
+	SSLKeyFilePath string `yaml:"ssl_key_file_path" mapstructure:"ssl_key_file_path" secret:"true"`
 	// Gives permission to autogenerate certificates if are missing
-	SSLAutoGenerateCerts string `yaml:"ssl_auto_generate_certs" mapstructure:"ssl_auto_generate_certs" default:"yes"`
+	SSLAutoGenerateCerts Flag `yaml:"ssl_auto_generate_certs" mapstructure:"ssl_auto_generate_certs" default:"true"`
 
 	// Allow Listening on HTTP only without encryption
-	EnableUnsecure string `yaml:"enable_unsecure" mapstructure:"enable_unsecure" default:"yes"`
+	EnableUnsecure Flag `yaml:"enable_unsecure" mapstructure:"enable_unsecure" default:"true"`
 
 	// HTTP Listening
 	ListeningAddresses []string `yaml:"listening_addresses" mapstructure:"listening_addresses"`
 	// HTTPS Listening
 	ListeningAddressesSSL []string `yaml:"listening_addresses_ssl" mapstructure:"listening_addresses_ssl"`
 
+	// Limits of the concurrent clients (sessions) by user, device and auth token
+	SessionLimits SessionLimits `yaml:"session_limits" mapstructure:"session_limits"`
+
+	// The recently disconnected clients, they can be seen in /server_status/clients/history
+	DisconnectHistory DisconnectHistory `yaml:"disconnect_history" mapstructure:"disconnect_history"`
+
 	// This is the logger configuration!
 	Logger loggerConfig.Config
 }
 
+// Session limit policies -> what happens when a new client exceeds a limit
+const (
+	// SessionLimitPolicyReject -> the new client is rejected with RejectStatusCode
+	SessionLimitPolicyReject = "reject"
+	// SessionLimitPolicyEvictOldest -> the oldest clients are disconnected
+	SessionLimitPolicyEvictOldest = "evict_oldest"
+	// SessionLimitPolicyEvictOldestSameDevice -> the oldest clients of the same device are disconnected,
+	// if there are not enough of them the new client is rejected
+	SessionLimitPolicyEvictOldestSameDevice = "evict_oldest_same_device"
+)
+
+// SessionLimits -> 0 means unlimited
+// They are checked when the client is authenticated (when the auth details are set)
+type SessionLimits struct {
+	MaxPerUser      int `yaml:"max_per_user" mapstructure:"max_per_user"`
+	MaxPerDevice    int `yaml:"max_per_device" mapstructure:"max_per_device"`
+	MaxPerAuthToken int `yaml:"max_per_auth_token" mapstructure:"max_per_auth_token"`
+	// Policy -> if empty, it's reject
+	Policy string `yaml:"policy" mapstructure:"policy" default:"reject"`
+	// RejectStatusCode -> 429 (Too Many Requests) or 409 (Conflict), if 0 it's 429
+	RejectStatusCode int `yaml:"reject_status_code" mapstructure:"reject_status_code" default:"429"`
+}
+
+// DisconnectHistory -> the history keeps at most Size clients, not older than MaxAge (0 means no age limit)
+// Set Size to 0 for disabling it
+type DisconnectHistory struct {
+	Size   int           `yaml:"size" mapstructure:"size" default:"1000"`
+	MaxAge time.Duration `yaml:"max_age" mapstructure:"max_age" default:"1h"`
+	// Kinds -> which clients are recorded, if empty it's DefaultDisconnectHistoryKinds
+	Kinds []string `yaml:"kinds" mapstructure:"kinds"`
+}
+
+// Disconnect history kinds -> the kinds of the clients (request, sse, websocket, hijacked) or disconnected
+const (
+	DisconnectHistoryKindRequest   = "request"
+	DisconnectHistoryKindSSE       = "sse"
+	DisconnectHistoryKindWebSocket = "websocket"
+	DisconnectHistoryKindHijacked  = "hijacked"
+	// DisconnectHistoryKindDisconnected -> the clients disconnected by the server (ex: session limit), of any kind
+	DisconnectHistoryKindDisconnected = "disconnected"
+)
+
+// DefaultDisconnectHistoryKinds -> the plain requests are recorded only if they are disconnected by the server
+var DefaultDisconnectHistoryKinds = []string{
+	DisconnectHistoryKindSSE,
+	DisconnectHistoryKindWebSocket,
+	DisconnectHistoryKindHijacked,
+	DisconnectHistoryKindDisconnected,
+}
+
+// IsValidDisconnectHistoryKind -> checks if the kind is known
+func IsValidDisconnectHistoryKind(kind string) bool {
+	switch kind {
+	case DisconnectHistoryKindRequest, DisconnectHistoryKindSSE, DisconnectHistoryKindWebSocket,
+		DisconnectHistoryKindHijacked, DisconnectHistoryKindDisconnected:
+		return true
+	}
+	return false
+}
+
+// IsValidSessionLimitPolicy -> checks if the policy is known
+func IsValidSessionLimitPolicy(policy string) bool {
+	switch policy {
+	case SessionLimitPolicyReject, SessionLimitPolicyEvictOldest, SessionLimitPolicyEvictOldestSameDevice:
+		return true
+	}
+	return false
+}
+
+const DefaultStatusUsername = "admin"
+const DefaultStatusPassword = "admin_password"
+
+type StatusAccount struct {
+	Username string `yaml:"username" mapstructure:"username"`
+	// Password -> plain, bcrypt or argon2 (PHC format) hash
+	Password string `yaml:"password" mapstructure:"password" secret:"true"`
+	// Scope -> read_only or admin, if empty it's read_only
+	Scope string `yaml:"scope" mapstructure:"scope" default:"read_only"`
+}
+
 // DefaultConfig -> it will return the default config with default values
 func DefaultConfig(configObj *Config) (Config, error) {
 	if configObj == nil {
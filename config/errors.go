@@ -0,0 +1,83 @@
+package config
+
+import (
+	"strings"
+)
+
+// FieldError -> describes a single invalid config field, Field is the yaml key path (ex: logger.dir_log_path)
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError -> it's a multi error which contains every invalid field found by Validate
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fieldErr := range e.Errors {
+		msgs = append(msgs, fieldErr.Error())
+	}
+	return "invalid http server config: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap -> allows errors.Is/errors.As to reach each field error
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, fieldErr := range e.Errors {
+		errs = append(errs, fieldErr)
+	}
+	return errs
+}
+
+// Add -> appends a new field error
+func (e *ValidationError) Add(field string, message string) {
+	e.Errors = append(e.Errors, &FieldError{
+		Field:   field,
+		Message: message,
+	})
+}
+
+// Field -> returns all the errors related to a specific field (yaml key path)
+func (e *ValidationError) Field(field string) []*FieldError {
+	var found []*FieldError
+	for _, fieldErr := range e.Errors {
+		if fieldErr.Field == field {
+			found = append(found, fieldErr)
+		}
+	}
+	return found
+}
+
+// Has -> checks if there is at least one error for the field (yaml key path)
+func (e *ValidationError) Has(field string) bool {
+	return len(e.Field(field)) > 0
+}
+
+// Fields -> returns the list of invalid fields (yaml key paths), without duplicates
+func (e *ValidationError) Fields() []string {
+	var fields []string
+	seen := make(map[string]bool)
+	for _, fieldErr := range e.Errors {
+		if seen[fieldErr.Field] {
+			continue
+		}
+		seen[fieldErr.Field] = true
+		fields = append(fields, fieldErr.Field)
+	}
+	return fields
+}
+
+// errOrNil -> returns nil when there are no errors, so the caller can directly return it
+func (e *ValidationError) errOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
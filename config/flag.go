@@ -0,0 +1,178 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type flagState uint8
+
+const (
+	flagUnset flagState = iota
+	flagTrue
+	flagFalse
+	flagInvalid
+)
+
+// Flag -> it's a tri-state boolean (unset, true, false) used by the config
+// For backward compatibility it can be unmarshalled from the legacy "yes"/"no" strings, and also from
+// real booleans, "true"/"false", "on"/"off" and "1"/"0"
+// Values that cannot be parsed are kept (see Raw) and reported by Config.Validate
+//
+// When decoding with mapstructure (viper), add FlagDecodeHook() to the decode hooks
+type Flag struct {
+	state flagState
+	// raw -> the original value, it's kept for invalid values, so they can be reported
+	raw string
+}
+
+// NewFlag -> creates a flag that has been set to the given value
+func NewFlag(value bool) Flag {
+	if value {
+		return Flag{state: flagTrue}
+	}
+	return Flag{state: flagFalse}
+}
+
+// ParseFlag -> parses the string, empty string means unset
+// Invalid values don't return an error, they can be checked with IsValid
+func ParseFlag(value string) Flag {
+	raw := strings.TrimSpace(value)
+	switch strings.ToLower(raw) {
+	case "":
+		return Flag{}
+	case "yes", "true", "on", "1":
+		return Flag{state: flagTrue}
+	case "no", "false", "off", "0":
+		return Flag{state: flagFalse}
+	default:
+		return Flag{state: flagInvalid, raw: raw}
+	}
+}
+
+// Bool -> returns true only if the flag has been set to true
+func (f Flag) Bool() bool {
+	return f.state == flagTrue
+}
+
+// IsSet -> if the flag has been set (even to an invalid value)
+func (f Flag) IsSet() bool {
+	return f.state != flagUnset
+}
+
+// IsValid -> false only when the flag has been set to a value that cannot be parsed
+func (f Flag) IsValid() bool {
+	return f.state != flagInvalid
+}
+
+// Raw -> returns the original value that could not be parsed
+func (f Flag) Raw() string {
+	return f.raw
+}
+
+func (f Flag) String() string {
+	switch f.state {
+	case flagTrue:
+		return "yes"
+	case flagFalse:
+		return "no"
+	case flagInvalid:
+		return f.raw
+	default:
+		return ""
+	}
+}
+
+// UnmarshalText -> used by mapstructure (through TextUnmarshallerHookFunc) and other text decoders
+func (f *Flag) UnmarshalText(text []byte) error {
+	*f = ParseFlag(string(text))
+	return nil
+}
+
+func (f Flag) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// UnmarshalJSON -> accepts booleans, strings, numbers and null
+func (f *Flag) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if _err := json.Unmarshal(data, &value); _err != nil {
+		return _err
+	}
+	f.fromInterface(value)
+	return nil
+}
+
+func (f Flag) MarshalJSON() ([]byte, error) {
+	switch f.state {
+	case flagTrue:
+		return []byte("true"), nil
+	case flagFalse:
+		return []byte("false"), nil
+	case flagInvalid:
+		return json.Marshal(f.raw)
+	default:
+		return []byte("null"), nil
+	}
+}
+
+// UnmarshalYAML -> it's compatible with both yaml.v2 and yaml.v3 (obsolete unmarshaler interface)
+func (f *Flag) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value interface{}
+	if _err := unmarshal(&value); _err != nil {
+		return _err
+	}
+	f.fromInterface(value)
+	return nil
+}
+
+func (f Flag) MarshalYAML() (interface{}, error) {
+	return f.String(), nil
+}
+
+func (f *Flag) fromInterface(value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		*f = Flag{}
+	case bool:
+		*f = NewFlag(v)
+	case string:
+		*f = ParseFlag(v)
+	case float32:
+		*f = ParseFlag(strconv.FormatFloat(float64(v), 'f', -1, 32))
+	case float64:
+		*f = ParseFlag(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			*f = ParseFlag(strconv.FormatInt(rv.Int(), 10))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			*f = ParseFlag(strconv.FormatUint(rv.Uint(), 10))
+		default:
+			*f = Flag{state: flagInvalid, raw: fmt.Sprint(v)}
+		}
+	}
+}
+
+var flagType = reflect.TypeOf(Flag{})
+
+// FlagDecodeHook -> a mapstructure decode hook (mapstructure.DecodeHookFuncType) which converts strings,
+// booleans and numbers into a Flag, the other target types are left untouched
+//
+//	viper.Unmarshal(&cfg, viper.DecodeHook(config.FlagDecodeHook()))
+//
+// It has no dependency on mapstructure, so it can be passed to any version of it
+func FlagDecodeHook() func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	return func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+		if to != flagType || from == flagType {
+			return data, nil
+		}
+		var f Flag
+		f.fromInterface(data)
+		return f, nil
+	}
+}
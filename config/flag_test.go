@@ -0,0 +1,160 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v3"
+)
+
+type flagHolder struct {
+	Enabled Flag `yaml:"enabled" json:"enabled" mapstructure:"enabled"`
+}
+
+// flagCase -> the source value and the flag it should be decoded into
+type flagCase struct {
+	name  string
+	value interface{}
+	isSet bool
+	bool  bool
+	valid bool
+	raw   string
+}
+
+var flagCases = []flagCase{
+	{name: "yes", value: "yes", isSet: true, bool: true, valid: true},
+	{name: "no", value: "no", isSet: true, bool: false, valid: true},
+	{name: "upper case yes", value: "YES", isSet: true, bool: true, valid: true},
+	{name: "true", value: true, isSet: true, bool: true, valid: true},
+	{name: "false", value: false, isSet: true, bool: false, valid: true},
+	{name: "string true", value: "true", isSet: true, bool: true, valid: true},
+	{name: "one", value: 1, isSet: true, bool: true, valid: true},
+	{name: "zero", value: 0, isSet: true, bool: false, valid: true},
+	{name: "invalid string", value: "maybe", isSet: true, valid: false, raw: "maybe"},
+	{name: "invalid number", value: 2, isSet: true, valid: false, raw: "2"},
+}
+
+func checkFlag(t *testing.T, test flagCase, f Flag) {
+	t.Helper()
+	if f.IsSet() != test.isSet || f.Bool() != test.bool || f.IsValid() != test.valid || f.Raw() != test.raw {
+		t.Errorf(
+			"%v: expected set=%v bool=%v valid=%v raw=%q, got set=%v bool=%v valid=%v raw=%q",
+			test.value, test.isSet, test.bool, test.valid, test.raw, f.IsSet(), f.Bool(), f.IsValid(), f.Raw(),
+		)
+	}
+}
+
+func TestFlagYAML(t *testing.T) {
+	for _, test := range flagCases {
+		t.Run(test.name, func(t *testing.T) {
+			// The value is written as it would be in a config file
+			source, _err := yaml.Marshal(map[string]interface{}{"enabled": test.value})
+			if _err != nil {
+				t.Fatal(_err)
+			}
+			var decoded flagHolder
+			if _err = yaml.Unmarshal(source, &decoded); _err != nil {
+				t.Fatal(_err)
+			}
+			checkFlag(t, test, decoded.Enabled)
+
+			encoded, _err := yaml.Marshal(decoded)
+			if _err != nil {
+				t.Fatal(_err)
+			}
+			var roundTrip flagHolder
+			if _err = yaml.Unmarshal(encoded, &roundTrip); _err != nil {
+				t.Fatal(_err)
+			}
+			if roundTrip.Enabled != decoded.Enabled {
+				t.Errorf("round trip through %q changed the flag: %+v -> %+v", encoded, decoded.Enabled, roundTrip.Enabled)
+			}
+		})
+	}
+}
+
+func TestFlagJSON(t *testing.T) {
+	for _, test := range flagCases {
+		t.Run(test.name, func(t *testing.T) {
+			source, _err := json.Marshal(map[string]interface{}{"enabled": test.value})
+			if _err != nil {
+				t.Fatal(_err)
+			}
+			var decoded flagHolder
+			if _err = json.Unmarshal(source, &decoded); _err != nil {
+				t.Fatal(_err)
+			}
+			checkFlag(t, test, decoded.Enabled)
+
+			encoded, _err := json.Marshal(decoded)
+			if _err != nil {
+				t.Fatal(_err)
+			}
+			var roundTrip flagHolder
+			if _err = json.Unmarshal(encoded, &roundTrip); _err != nil {
+				t.Fatal(_err)
+			}
+			if roundTrip.Enabled != decoded.Enabled {
+				t.Errorf("round trip through %s changed the flag: %+v -> %+v", encoded, decoded.Enabled, roundTrip.Enabled)
+			}
+		})
+	}
+}
+
+func decodeWithHook(t *testing.T, input interface{}) flagHolder {
+	t.Helper()
+	var decoded flagHolder
+	decoder, _err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: FlagDecodeHook(),
+		Result:     &decoded,
+	})
+	if _err != nil {
+		t.Fatal(_err)
+	}
+	if _err = decoder.Decode(input); _err != nil {
+		t.Fatal(_err)
+	}
+	return decoded
+}
+
+func TestFlagMapstructure(t *testing.T) {
+	// The integer types viper could produce, depending on the config format
+	intCases := []flagCase{
+		{name: "int64 one", value: int64(1), isSet: true, bool: true, valid: true},
+		{name: "uint zero", value: uint(0), isSet: true, bool: false, valid: true},
+		{name: "float one", value: float64(1), isSet: true, bool: true, valid: true},
+	}
+	for _, test := range append(flagCases, intCases...) {
+		t.Run(test.name, func(t *testing.T) {
+			decoded := decodeWithHook(t, map[string]interface{}{"enabled": test.value})
+			checkFlag(t, test, decoded.Enabled)
+
+			// Written back as text (ex: viper.WriteConfig) and decoded again
+			encoded, _err := decoded.Enabled.MarshalText()
+			if _err != nil {
+				t.Fatal(_err)
+			}
+			roundTrip := decodeWithHook(t, map[string]interface{}{"enabled": string(encoded)})
+			if roundTrip.Enabled != decoded.Enabled {
+				t.Errorf("round trip changed the flag: %+v -> %+v", decoded.Enabled, roundTrip.Enabled)
+			}
+		})
+	}
+}
+
+func TestFlagMapstructureUnset(t *testing.T) {
+	decoded := decodeWithHook(t, map[string]interface{}{})
+	if decoded.Enabled.IsSet() {
+		t.Errorf("a missing key should keep the flag unset, got: %+v", decoded.Enabled)
+	}
+	decoded = decodeWithHook(t, map[string]interface{}{"enabled": ""})
+	if decoded.Enabled.IsSet() || !decoded.Enabled.IsValid() {
+		t.Errorf("an empty string should keep the flag unset, got: %+v", decoded.Enabled)
+	}
+	// Already decoded flags are kept as they are
+	decoded = decodeWithHook(t, map[string]interface{}{"enabled": NewFlag(true)})
+	if !decoded.Enabled.Bool() {
+		t.Errorf("expected the flag to be kept, got: %+v", decoded.Enabled)
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"encoding"
+	"reflect"
+	"strings"
+)
+
+// RedactedValue -> it replaces the values of the fields tagged with secret:"true"
+const RedactedValue = "[REDACTED]"
+
+// Redact -> converts the config into a map keyed by the yaml key names, the fields tagged with secret:"true"
+// are redacted and the fields with yaml:"-" are skipped
+// It's used for outputting the effective config (logs, status endpoint)
+func Redact(c Config) map[string]interface{} {
+	return redactStruct(reflect.ValueOf(c))
+}
+
+func redactStruct(v reflect.Value) map[string]interface{} {
+	out := make(map[string]interface{})
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		key := yamlKey(field)
+		if key == "-" {
+			continue
+		}
+		value := v.Field(i)
+		if field.Tag.Get("secret") == "true" {
+			if value.IsZero() {
+				out[key] = value.Interface()
+			} else {
+				out[key] = RedactedValue
+			}
+			continue
+		}
+		out[key] = redactValue(value)
+	}
+	return out
+}
+
+func redactValue(v reflect.Value) interface{} {
+	// Types like Flag know how to represent themselves
+	if v.CanInterface() {
+		if _, ok := v.Interface().(encoding.TextMarshaler); ok {
+			return v.Interface()
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return redactStruct(v)
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		items := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, redactValue(v.Index(i)))
+		}
+		return items
+	case reflect.Interface, reflect.Ptr, reflect.Func, reflect.Chan:
+		// These can't be represented (writers, loggers...)
+		return nil
+	default:
+		return v.Interface()
+	}
+}
+
+// yamlKey -> the key name used by yaml, if there is no tag it's the lowercased field name
+func yamlKey(field reflect.StructField) string {
+	tag := field.Tag.Get("yaml")
+	if tag != "" {
+		name := strings.Split(tag, ",")[0]
+		if name != "" {
+			return name
+		}
+	}
+	return strings.ToLower(field.Name)
+}
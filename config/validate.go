@@ -0,0 +1,213 @@
+package config
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/kyaxcorp/go-helper/network/port"
+	"github.com/kyaxcorp/go-http/middlewares/status_auth"
+)
+
+// Validate -> checks the entire config and returns a *ValidationError containing every invalid field,
+// or nil if the config is valid
+func (c *Config) Validate() error {
+	errs := &ValidationError{}
+
+	// Flags which couldn't be parsed (ex: "ture")
+	flags := []struct {
+		field string
+		flag  Flag
+	}{
+		{"is_enabled", c.IsEnabled},
+		{"enable_server_status", c.EnableServerStatus},
+		{"enable_ssl", c.EnableSSL},
+		{"ssl_auto_generate_certs", c.SSLAutoGenerateCerts},
+		{"enable_unsecure", c.EnableUnsecure},
+		{"server_status_allow_insecure_defaults", c.ServerStatusAllowInsecureDefaults},
+	}
+	for _, f := range flags {
+		if !f.flag.IsValid() {
+			errs.Add(f.field, "invalid boolean value \""+f.flag.Raw()+"\", expected yes/no or true/false")
+		}
+	}
+
+	enableUnsecure := c.EnableUnsecure.Bool()
+	enableSSL := c.EnableSSL.Bool()
+
+	// Conflicting flags
+	if !enableUnsecure && !enableSSL {
+		errs.Add("enable_unsecure", "both unsecure and ssl connections are disabled, there is nothing to listen on")
+	}
+
+	if enableUnsecure && len(c.ListeningAddresses) == 0 {
+		errs.Add("listening_addresses", "unsecure connections are enabled but no listening addresses are provided")
+	}
+	if enableSSL && len(c.ListeningAddressesSSL) == 0 {
+		errs.Add("listening_addresses_ssl", "ssl connections are enabled but no listening addresses are provided")
+	}
+
+	// Address syntax and duplicates across plain and ssl
+	usedAddresses := make(map[string]string)
+	validateAddresses := func(field string, addresses []string) {
+		for i, address := range addresses {
+			fieldPath := field + "[" + strconv.Itoa(i) + "]"
+			if msg := validateAddress(address); msg != "" {
+				errs.Add(fieldPath, msg)
+				continue
+			}
+			filtered := port.FilterAddress(address)
+			if usedBy, ok := usedAddresses[filtered]; ok {
+				errs.Add(fieldPath, "address "+filtered+" is duplicated, already used by "+usedBy)
+				continue
+			}
+			usedAddresses[filtered] = fieldPath
+		}
+	}
+	validateAddresses("listening_addresses", c.ListeningAddresses)
+	validateAddresses("listening_addresses_ssl", c.ListeningAddressesSSL)
+
+	// Certificates
+	if enableSSL {
+		certEmpty := c.SSLCertFilePath == ""
+		keyEmpty := c.SSLKeyFilePath == ""
+
+		switch {
+		case certEmpty && keyEmpty:
+			if !c.SSLAutoGenerateCerts.Bool() {
+				errs.Add("ssl_cert_file_path", "ssl is enabled, certificate and key are empty and auto generation is disabled")
+			}
+		case certEmpty:
+			errs.Add("ssl_cert_file_path", "certificate path is empty while key path is set")
+		case keyEmpty:
+			errs.Add("ssl_key_file_path", "key path is empty while certificate path is set")
+		default:
+			certReadable := validateReadableFile(errs, "ssl_cert_file_path", c.SSLCertFilePath)
+			keyReadable := validateReadableFile(errs, "ssl_key_file_path", c.SSLKeyFilePath)
+			if certReadable && keyReadable {
+				if _, _err := tls.LoadX509KeyPair(c.SSLCertFilePath, c.SSLKeyFilePath); _err != nil {
+					errs.Add("ssl_key_file_path", "certificate and key don't match: "+_err.Error())
+				}
+			}
+		}
+	}
+
+	// Server status
+	if c.EnableServerStatus.Bool() {
+		c.validateStatusCredentials(errs)
+	}
+
+	c.SessionLimits.validate(errs)
+
+	if c.DisconnectHistory.Size < 0 {
+		errs.Add("disconnect_history.size", "size is negative, use 0 for disabling the history")
+	}
+	if c.DisconnectHistory.MaxAge < 0 {
+		errs.Add("disconnect_history.max_age", "max age is negative, use 0 for no age limit")
+	}
+	for i, kind := range c.DisconnectHistory.Kinds {
+		if !IsValidDisconnectHistoryKind(kind) {
+			errs.Add(
+				"disconnect_history.kinds["+strconv.Itoa(i)+"]",
+				"invalid kind \""+kind+"\", expected request, sse, websocket, hijacked or disconnected",
+			)
+		}
+	}
+
+	return errs.errOrNil()
+}
+
+// validateAddress -> returns an error message if the address is not in host:port format
+// The "+" char (auto searching for a free port) is accepted
+func validateAddress(address string) string {
+	if address == "" {
+		return "address is empty"
+	}
+	_, portStr, _err := net.SplitHostPort(port.FilterAddress(address))
+	if _err != nil {
+		return "invalid address " + address + ": " + _err.Error()
+	}
+	if _, _err = strconv.ParseUint(portStr, 10, 16); _err != nil {
+		return "invalid port in address " + address
+	}
+	return ""
+}
+
+func validateReadableFile(errs *ValidationError, field string, path string) bool {
+	f, _err := os.Open(path)
+	if _err != nil {
+		errs.Add(field, "file is not readable: "+_err.Error())
+		return false
+	}
+	_ = f.Close()
+	return true
+}
+
+func (c *Config) validateStatusCredentials(errs *ValidationError) {
+	allowInsecure := c.ServerStatusAllowInsecureDefaults.Bool()
+	validatePassword := func(field string, password string) {
+		if password == "" {
+			errs.Add(field, "password is empty")
+			return
+		}
+		if password == DefaultStatusPassword && !allowInsecure {
+			errs.Add(field, "the default status password is not allowed, change it or enable server_status_allow_insecure_defaults")
+			return
+		}
+		if _err := status_auth.CheckPassword(password); _err != nil {
+			errs.Add(field, _err.Error())
+		}
+	}
+
+	usernames := make(map[string]string)
+	if c.ServerStatusUsername != "" || c.ServerStatusPassword != "" {
+		if c.ServerStatusUsername == "" {
+			errs.Add("server_status_username", "server status is enabled but username is empty")
+		} else {
+			usernames[c.ServerStatusUsername] = "server_status_username"
+		}
+		validatePassword("server_status_password", c.ServerStatusPassword)
+	} else if len(c.ServerStatusAccounts) == 0 {
+		errs.Add("server_status_username", "server status is enabled but no credentials are provided")
+	}
+
+	for i, account := range c.ServerStatusAccounts {
+		fieldPath := "server_status_accounts[" + strconv.Itoa(i) + "]"
+		if account.Username == "" {
+			errs.Add(fieldPath+".username", "username is empty")
+		} else if usedBy, ok := usernames[account.Username]; ok {
+			errs.Add(fieldPath+".username", "username "+account.Username+" is duplicated, already used by "+usedBy)
+		} else {
+			usernames[account.Username] = fieldPath + ".username"
+		}
+		validatePassword(fieldPath+".password", account.Password)
+		if account.Scope != "" && !status_auth.IsValidScope(status_auth.Scope(account.Scope)) {
+			errs.Add(fieldPath+".scope", "invalid scope \""+account.Scope+"\", expected read_only or admin")
+		}
+	}
+}
+
+func (l SessionLimits) validate(errs *ValidationError) {
+	limits := []struct {
+		field string
+		value int
+	}{
+		{"session_limits.max_per_user", l.MaxPerUser},
+		{"session_limits.max_per_device", l.MaxPerDevice},
+		{"session_limits.max_per_auth_token", l.MaxPerAuthToken},
+	}
+	for _, limit := range limits {
+		if limit.value < 0 {
+			errs.Add(limit.field, "limit is negative, use 0 for unlimited")
+		}
+	}
+	// Only the values which have been set are checked, the empty policy means reject and 0 means 429
+	if l.Policy != "" && !IsValidSessionLimitPolicy(l.Policy) {
+		errs.Add("session_limits.policy", "invalid policy \""+l.Policy+"\", expected reject, evict_oldest or evict_oldest_same_device")
+	}
+	if l.RejectStatusCode != 0 && l.RejectStatusCode != http.StatusTooManyRequests && l.RejectStatusCode != http.StatusConflict {
+		errs.Add("session_limits.reject_status_code", "invalid status code "+strconv.Itoa(l.RejectStatusCode)+", expected 429 or 409")
+	}
+}
@@ -0,0 +1,411 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// certPair -> the paths of a self signed certificate and its key
+type certPair struct {
+	cert string
+	key  string
+}
+
+func writeCertPair(t *testing.T, dir string, name string) certPair {
+	t.Helper()
+	key, _err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if _err != nil {
+		t.Fatal(_err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, _err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if _err != nil {
+		t.Fatal(_err)
+	}
+	keyDer, _err := x509.MarshalECPrivateKey(key)
+	if _err != nil {
+		t.Fatal(_err)
+	}
+
+	pair := certPair{
+		cert: filepath.Join(dir, name+".crt"),
+		key:  filepath.Join(dir, name+".key"),
+	}
+	if _err = os.WriteFile(pair.cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); _err != nil {
+		t.Fatal(_err)
+	}
+	if _err = os.WriteFile(pair.key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); _err != nil {
+		t.Fatal(_err)
+	}
+	return pair
+}
+
+// validBaseConfig -> a valid config listening only on a plain address
+func validBaseConfig(t *testing.T) Config {
+	t.Helper()
+	cfg, _err := DefaultConfig(nil)
+	if _err != nil {
+		t.Fatal(_err)
+	}
+	cfg.EnableServerStatus = NewFlag(false)
+	cfg.EnableSSL = NewFlag(false)
+	cfg.EnableUnsecure = NewFlag(true)
+	cfg.ListeningAddresses = []string{"127.0.0.1:8080"}
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	first := writeCertPair(t, dir, "first")
+	second := writeCertPair(t, dir, "second")
+	missing := filepath.Join(dir, "missing.pem")
+
+	withSSL := func(c *Config) {
+		c.EnableSSL = NewFlag(true)
+		c.ListeningAddressesSSL = []string{"127.0.0.1:8443"}
+		c.SSLCertFilePath = first.cert
+		c.SSLKeyFilePath = first.key
+	}
+
+	withStatusPassword := func(c *Config, password string) {
+		c.EnableServerStatus = NewFlag(true)
+		c.ServerStatusUsername = "admin"
+		c.ServerStatusPassword = password
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		// fields -> the exact list of invalid fields, empty for a valid config
+		fields []string
+		// contains -> a part of the message of the first invalid field
+		contains string
+	}{
+		{
+			name:   "valid",
+			modify: func(c *Config) {},
+		},
+		{
+			name: "auto searching port is accepted",
+			modify: func(c *Config) {
+				c.ListeningAddresses = []string{"127.0.0.1:8080+"}
+			},
+		},
+		{
+			name: "nothing to listen on",
+			modify: func(c *Config) {
+				c.EnableUnsecure = NewFlag(false)
+			},
+			fields:   []string{"enable_unsecure"},
+			contains: "nothing to listen on",
+		},
+		{
+			name: "unsecure without addresses",
+			modify: func(c *Config) {
+				c.ListeningAddresses = nil
+			},
+			fields:   []string{"listening_addresses"},
+			contains: "no listening addresses",
+		},
+		{
+			name: "ssl without addresses",
+			modify: func(c *Config) {
+				withSSL(c)
+				c.ListeningAddressesSSL = nil
+			},
+			fields:   []string{"listening_addresses_ssl"},
+			contains: "no listening addresses",
+		},
+		{
+			name: "empty address",
+			modify: func(c *Config) {
+				c.ListeningAddresses = []string{""}
+			},
+			fields:   []string{"listening_addresses[0]"},
+			contains: "address is empty",
+		},
+		{
+			name: "address without port",
+			modify: func(c *Config) {
+				c.ListeningAddresses = []string{"127.0.0.1:8080", "localhost"}
+			},
+			fields:   []string{"listening_addresses[1]"},
+			contains: "invalid address localhost",
+		},
+		{
+			name: "port out of range",
+			modify: func(c *Config) {
+				c.ListeningAddresses = []string{"127.0.0.1:99999"}
+			},
+			fields:   []string{"listening_addresses[0]"},
+			contains: "invalid port",
+		},
+		{
+			name: "duplicated plain address",
+			modify: func(c *Config) {
+				c.ListeningAddresses = []string{"127.0.0.1:8080", "127.0.0.1:8080"}
+			},
+			fields:   []string{"listening_addresses[1]"},
+			contains: "already used by listening_addresses[0]",
+		},
+		{
+			name: "duplicated after removing the auto searching char",
+			modify: func(c *Config) {
+				c.ListeningAddresses = []string{"127.0.0.1:8080", "127.0.0.1:8080+"}
+			},
+			fields:   []string{"listening_addresses[1]"},
+			contains: "already used by listening_addresses[0]",
+		},
+		{
+			name: "duplicated across plain and ssl",
+			modify: func(c *Config) {
+				withSSL(c)
+				c.ListeningAddressesSSL = []string{"127.0.0.1:8080"}
+			},
+			fields:   []string{"listening_addresses_ssl[0]"},
+			contains: "already used by listening_addresses[0]",
+		},
+		{
+			name:   "matching certificate and key",
+			modify: withSSL,
+		},
+		{
+			name: "certificate and key are empty",
+			modify: func(c *Config) {
+				withSSL(c)
+				c.SSLCertFilePath = ""
+				c.SSLKeyFilePath = ""
+				c.SSLAutoGenerateCerts = NewFlag(false)
+			},
+			fields:   []string{"ssl_cert_file_path"},
+			contains: "auto generation is disabled",
+		},
+		{
+			name: "certificate and key are empty with auto generation",
+			modify: func(c *Config) {
+				withSSL(c)
+				c.SSLCertFilePath = ""
+				c.SSLKeyFilePath = ""
+				c.SSLAutoGenerateCerts = NewFlag(true)
+			},
+		},
+		{
+			name: "certificate is empty",
+			modify: func(c *Config) {
+				withSSL(c)
+				c.SSLCertFilePath = ""
+			},
+			fields:   []string{"ssl_cert_file_path"},
+			contains: "certificate path is empty",
+		},
+		{
+			name: "key is empty",
+			modify: func(c *Config) {
+				withSSL(c)
+				c.SSLKeyFilePath = ""
+			},
+			fields:   []string{"ssl_key_file_path"},
+			contains: "key path is empty",
+		},
+		{
+			name: "certificate is not readable",
+			modify: func(c *Config) {
+				withSSL(c)
+				c.SSLCertFilePath = missing
+			},
+			fields:   []string{"ssl_cert_file_path"},
+			contains: "file is not readable",
+		},
+		{
+			name: "key is not readable",
+			modify: func(c *Config) {
+				withSSL(c)
+				c.SSLKeyFilePath = missing
+			},
+			fields:   []string{"ssl_key_file_path"},
+			contains: "file is not readable",
+		},
+		{
+			name: "certificate and key are not readable",
+			modify: func(c *Config) {
+				withSSL(c)
+				c.SSLCertFilePath = missing
+				c.SSLKeyFilePath = missing
+			},
+			fields:   []string{"ssl_cert_file_path", "ssl_key_file_path"},
+			contains: "file is not readable",
+		},
+		{
+			name: "certificate and key don't match",
+			modify: func(c *Config) {
+				withSSL(c)
+				c.SSLKeyFilePath = second.key
+			},
+			fields:   []string{"ssl_key_file_path"},
+			contains: "don't match",
+		},
+		{
+			name: "certificate files are not checked when ssl is disabled",
+			modify: func(c *Config) {
+				c.SSLCertFilePath = missing
+				c.SSLKeyFilePath = second.key
+			},
+		},
+		{
+			name: "session limits with the default policy and status code",
+			modify: func(c *Config) {
+				c.SessionLimits = SessionLimits{MaxPerUser: 2}
+			},
+		},
+		{
+			name: "invalid session limit policy",
+			modify: func(c *Config) {
+				c.SessionLimits.Policy = "evict_newest"
+			},
+			fields:   []string{"session_limits.policy"},
+			contains: "invalid policy \"evict_newest\"",
+		},
+		{
+			name: "invalid session limit status code",
+			modify: func(c *Config) {
+				c.SessionLimits.RejectStatusCode = 403
+			},
+			fields:   []string{"session_limits.reject_status_code"},
+			contains: "invalid status code 403",
+		},
+		{
+			name: "disconnect history kinds",
+			modify: func(c *Config) {
+				c.DisconnectHistory.Kinds = []string{"sse", "disconnected"}
+			},
+		},
+		{
+			name: "invalid disconnect history kind",
+			modify: func(c *Config) {
+				c.DisconnectHistory.Kinds = []string{"sse", "streaming"}
+			},
+			fields:   []string{"disconnect_history.kinds[1]"},
+			contains: "invalid kind \"streaming\"",
+		},
+		{
+			name: "argon2 status password with zero time",
+			modify: func(c *Config) {
+				withStatusPassword(c, "$argon2id$v=19$m=64,t=0,p=1$c29tZXNhbHQ$aGFzaA")
+			},
+			fields:   []string{"server_status_password"},
+			contains: "t should be at least 1",
+		},
+		{
+			name: "argon2 status password with zero threads",
+			modify: func(c *Config) {
+				withStatusPassword(c, "$argon2id$v=19$m=64,t=1,p=0$c29tZXNhbHQ$aGFzaA")
+			},
+			fields:   []string{"server_status_password"},
+			contains: "p should be at least 1",
+		},
+		{
+			name: "argon2 status password with too low memory",
+			modify: func(c *Config) {
+				withStatusPassword(c, "$argon2id$v=19$m=8,t=1,p=2$c29tZXNhbHQ$aGFzaA")
+			},
+			fields:   []string{"server_status_password"},
+			contains: "m should be at least 8*p",
+		},
+		{
+			name: "argon2 status password with empty salt",
+			modify: func(c *Config) {
+				withStatusPassword(c, "$argon2id$v=19$m=64,t=1,p=1$$aGFzaA")
+			},
+			fields:   []string{"server_status_password"},
+			contains: "salt is empty",
+		},
+		{
+			name: "argon2 status password",
+			modify: func(c *Config) {
+				withStatusPassword(c, "$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$aGFzaA")
+			},
+		},
+		{
+			name: "invalid flag",
+			modify: func(c *Config) {
+				c.EnableSSL = ParseFlag("ture")
+			},
+			fields:   []string{"enable_ssl"},
+			contains: "invalid boolean value \"ture\"",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := validBaseConfig(t)
+			test.modify(&cfg)
+			_err := cfg.Validate()
+
+			if len(test.fields) == 0 {
+				if _err != nil {
+					t.Fatalf("expected a valid config, got: %v", _err)
+				}
+				return
+			}
+
+			var errs *ValidationError
+			if !errors.As(_err, &errs) {
+				t.Fatalf("expected a *ValidationError, got: %v", _err)
+			}
+			for _, field := range test.fields {
+				if !errs.Has(field) {
+					t.Errorf("expected an error for %s, got: %v", field, errs.Fields())
+				}
+			}
+			if !reflect.DeepEqual(errs.Fields(), test.fields) {
+				t.Errorf("expected the invalid fields %v, got %v", test.fields, errs.Fields())
+			}
+			fieldErrs := errs.Field(test.fields[0])
+			if len(fieldErrs) == 0 || !strings.Contains(fieldErrs[0].Message, test.contains) {
+				t.Errorf("expected the message of %s to contain %q, got: %v", test.fields[0], test.contains, fieldErrs)
+			}
+		})
+	}
+}
+
+func TestValidationErrorField(t *testing.T) {
+	errs := &ValidationError{}
+	if errs.errOrNil() != nil {
+		t.Fatal("expected nil for no errors")
+	}
+	errs.Add("listening_addresses[0]", "first")
+	errs.Add("ssl_key_file_path", "second")
+	errs.Add("listening_addresses[0]", "third")
+
+	if !errs.Has("listening_addresses[0]") || errs.Has("listening_addresses") {
+		t.Errorf("Has should match the exact field, got: %v", errs.Fields())
+	}
+	if fieldErrs := errs.Field("listening_addresses[0]"); len(fieldErrs) != 2 || fieldErrs[1].Message != "third" {
+		t.Errorf("expected 2 errors in order for listening_addresses[0], got: %v", fieldErrs)
+	}
+	if fields := errs.Fields(); !reflect.DeepEqual(fields, []string{"listening_addresses[0]", "ssl_key_file_path"}) {
+		t.Errorf("unexpected fields: %v", fields)
+	}
+	var fieldErr *FieldError
+	if !errors.As(errs, &fieldErr) || fieldErr.Field != "listening_addresses[0]" {
+		t.Errorf("errors.As should reach the first field error, got: %v", fieldErr)
+	}
+}
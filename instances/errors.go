@@ -0,0 +1,39 @@
+package instances
+
+import (
+	"sort"
+	"strings"
+)
+
+// Errors -> the errors by instance name
+type Errors map[string]error
+
+func (e Errors) Error() string {
+	names := make([]string, 0, len(e))
+	for instanceName := range e {
+		names = append(names, instanceName)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, 0, len(names))
+	for _, instanceName := range names {
+		msgs = append(msgs, instanceName+": "+e[instanceName].Error())
+	}
+	return "http server instances: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap -> allows errors.Is/errors.As to reach each instance error
+func (e Errors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, _err := range e {
+		errs = append(errs, _err)
+	}
+	return errs
+}
+
+func (e Errors) errOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
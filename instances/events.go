@@ -0,0 +1,82 @@
+package instances
+
+import (
+	"github.com/kyaxcorp/go-helper/function"
+	"github.com/kyaxcorp/go-helper/sync/_map_string_interface"
+	server "github.com/kyaxcorp/go-http"
+)
+
+type OnInstanceEvent func(instanceName string, s *server.Server)
+
+// The name under which the registry is subscribed to the server start/stop callbacks
+const serverCallbackName = "instances_registry"
+
+var onAdded = _map_string_interface.New()
+var onRemoved = _map_string_interface.New()
+var onStarted = _map_string_interface.New()
+var onStopped = _map_string_interface.New()
+
+func subscribe(callbacks *_map_string_interface.MapStringInterface, name string, callback OnInstanceEvent) bool {
+	if !function.IsCallable(callback) || name == "" {
+		return false
+	}
+	callbacks.Set(name, callback)
+	return true
+}
+
+func fire(callbacks *_map_string_interface.MapStringInterface, instanceName string, s *server.Server) {
+	callbacks.Scan(func(k string, v interface{}) {
+		v.(OnInstanceEvent)(instanceName, s)
+	})
+}
+
+// OnAdded -> called when an instance is registered
+func OnAdded(name string, callback OnInstanceEvent) bool {
+	return subscribe(onAdded, name, callback)
+}
+
+// OnRemoved -> called when an instance is removed (after it has been stopped)
+func OnRemoved(name string, callback OnInstanceEvent) bool {
+	return subscribe(onRemoved, name, callback)
+}
+
+// OnStarted -> called when a registered instance has started
+func OnStarted(name string, callback OnInstanceEvent) bool {
+	return subscribe(onStarted, name, callback)
+}
+
+// OnStopped -> called when a registered instance has stopped
+func OnStopped(name string, callback OnInstanceEvent) bool {
+	return subscribe(onStopped, name, callback)
+}
+
+func OnAddedRemove(name string) {
+	onAdded.Del(name)
+}
+
+func OnRemovedRemove(name string) {
+	onRemoved.Del(name)
+}
+
+func OnStartedRemove(name string) {
+	onStarted.Del(name)
+}
+
+func OnStoppedRemove(name string) {
+	onStopped.Del(name)
+}
+
+// watch -> forwards the server start/stop events to the registry subscribers
+func watch(instanceName string, s *server.Server) {
+	s.OnStarted(serverCallbackName, func(s *server.Server) {
+		fire(onStarted, instanceName, s)
+	})
+	s.OnStopped(serverCallbackName, func(s *server.Server) {
+		fire(onStopped, instanceName, s)
+	})
+}
+
+func unwatch(s *server.Server) {
+	s.OnStartedRemove(serverCallbackName)
+	s.OnStoppedRemove(serverCallbackName)
+}
@@ -1,10 +1,13 @@
 package instances
 
 import (
+	"sort"
 	"sync"
 
+	"github.com/kyaxcorp/go-helper/_context"
 	"github.com/kyaxcorp/go-helper/errors2/define"
 	server "github.com/kyaxcorp/go-http"
+	"github.com/kyaxcorp/go-http/config"
 )
 
 // Here we store the created instances...
@@ -19,12 +22,25 @@ But the user can also can create analogic instances or duplicates based on the c
 All instances should be saved as reference in a global var
 */
 
-func SaveInstance(instanceName string, server *server.Server) {
+// SaveInstance -> registers the server under the name, it returns an error if the name is already registered
+func SaveInstance(instanceName string, server *server.Server) error {
+	if instanceName == "" {
+		return define.Err(0, "http server instance name is empty")
+	}
+	if server == nil {
+		return define.Err(0, "http server instance is nil", instanceName)
+	}
 	instancesLock.Lock()
-	if _, ok := instances[instanceName]; !ok {
-		instances[instanceName] = server
+	if _, ok := instances[instanceName]; ok {
+		instancesLock.Unlock()
+		return define.Err(0, "http server instance already registered", instanceName)
 	}
+	instances[instanceName] = server
 	instancesLock.Unlock()
+
+	watch(instanceName, server)
+	fire(onAdded, instanceName, server)
+	return nil
 }
 
 func GetInstance(instanceName string) (*server.Server, error) {
@@ -36,3 +52,128 @@ func GetInstance(instanceName string) (*server.Server, error) {
 	}
 	return nil, define.Err(0, "http server instance missing")
 }
+
+// MustGet -> same as GetInstance, but it panics if the instance is missing
+func MustGet(instanceName string) *server.Server {
+	instance, _err := GetInstance(instanceName)
+	if _err != nil {
+		panic("http server instance missing: " + instanceName)
+	}
+	return instance
+}
+
+// CreateFromConfig -> creates the server and registers it under the name
+// If the config has no name, the instance name is used
+func CreateFromConfig(instanceName string, cfg config.Config) (*server.Server, error) {
+	if instanceName == "" {
+		return nil, define.Err(0, "http server instance name is empty")
+	}
+	// Checking before creating, so we don't create the server for nothing
+	instancesLock.RLock()
+	_, exists := instances[instanceName]
+	instancesLock.RUnlock()
+	if exists {
+		return nil, define.Err(0, "http server instance already registered", instanceName)
+	}
+
+	if cfg.Name == "" {
+		cfg.Name = instanceName
+	}
+	s, _err := server.New(_context.GetDefaultContext(), cfg)
+	if _err != nil {
+		return nil, _err
+	}
+	if _err = SaveInstance(instanceName, s); _err != nil {
+		return nil, _err
+	}
+	return s, nil
+}
+
+// CreateAllFromConfigs -> creates and registers a server for each config
+// The ones which have been created successfully remain registered, the failed ones are returned in Errors
+func CreateAllFromConfigs(configs map[string]config.Config) (map[string]*server.Server, error) {
+	created := make(map[string]*server.Server)
+	errs := Errors{}
+	for instanceName, cfg := range configs {
+		s, _err := CreateFromConfig(instanceName, cfg)
+		if _err != nil {
+			errs[instanceName] = _err
+			continue
+		}
+		created[instanceName] = s
+	}
+	return created, errs.errOrNil()
+}
+
+// List -> returns the names of the registered instances (sorted)
+func List() []string {
+	instancesLock.RLock()
+	names := make([]string, 0, len(instances))
+	for instanceName := range instances {
+		names = append(names, instanceName)
+	}
+	instancesLock.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Remove -> stops the server and removes it from the registered instances
+func Remove(instanceName string) error {
+	instancesLock.Lock()
+	instance, ok := instances[instanceName]
+	if !ok {
+		instancesLock.Unlock()
+		return define.Err(0, "http server instance missing", instanceName)
+	}
+	delete(instances, instanceName)
+	instancesLock.Unlock()
+
+	_err := instance.Stop()
+	unwatch(instance)
+	fire(onRemoved, instanceName, instance)
+	return _err
+}
+
+// StartAll -> starts all the registered instances in parallel
+func StartAll() error {
+	return runAll(func(s *server.Server) error {
+		return s.Start()
+	})
+}
+
+// StopAll -> stops all the registered instances in parallel
+func StopAll() error {
+	return runAll(func(s *server.Server) error {
+		return s.Stop()
+	})
+}
+
+func snapshot() map[string]*server.Server {
+	instancesLock.RLock()
+	defer instancesLock.RUnlock()
+	nmap := make(map[string]*server.Server, len(instances))
+	for instanceName, instance := range instances {
+		nmap[instanceName] = instance
+	}
+	return nmap
+}
+
+func runAll(action func(s *server.Server) error) error {
+	var awaitGroup sync.WaitGroup
+	var errsLock sync.Mutex
+	errs := Errors{}
+
+	for instanceName, instance := range snapshot() {
+		awaitGroup.Add(1)
+		go func(instanceName string, instance *server.Server) {
+			defer awaitGroup.Done()
+			if _err := action(instance); _err != nil {
+				errsLock.Lock()
+				errs[instanceName] = _err
+				errsLock.Unlock()
+			}
+		}(instanceName, instance)
+	}
+	awaitGroup.Wait()
+	return errs.errOrNil()
+}
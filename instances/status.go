@@ -0,0 +1,55 @@
+package instances
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	server "github.com/kyaxcorp/go-http"
+	"github.com/kyaxcorp/go-http/middlewares/status_auth"
+)
+
+type InstanceStatus struct {
+	Name        string
+	Description string
+	IsStarted   bool
+	Status      server.Status
+	NrOfClients server.NrOfClientsStatus
+}
+
+type AggregatedStatus struct {
+	NrOfInstances int
+	NrOfClients   uint
+	Instances     map[string]InstanceStatus
+}
+
+// Status -> collects the status of every registered instance, keyed by instance name
+func Status() AggregatedStatus {
+	status := AggregatedStatus{
+		Instances: make(map[string]InstanceStatus),
+	}
+	for instanceName, instance := range snapshot() {
+		instanceStatus := InstanceStatus{
+			Name:        instance.Name,
+			Description: instance.GetDescription(),
+			IsStarted:   instance.IsStarted(),
+			Status:      instance.GetServerStatus(),
+			NrOfClients: instance.GetNrOfClientsStatus(),
+		}
+		status.Instances[instanceName] = instanceStatus
+		status.NrOfClients += instanceStatus.NrOfClients.NrOfClients
+	}
+	status.NrOfInstances = len(status.Instances)
+	return status
+}
+
+// StatusHandler -> responds with the aggregated status of all the instances
+func StatusHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.IndentedJSON(http.StatusOK, Status())
+	}
+}
+
+// EnableStatusRoute -> adds /server_status/instances to the server, protected by its status accounts
+func EnableStatusRoute(s *server.Server) {
+	s.AddStatusRoute("/instances", status_auth.ScopeReadOnly, StatusHandler())
+}
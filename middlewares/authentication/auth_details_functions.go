@@ -1,6 +1,10 @@
 package authentication
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 func (a *AuthDetails) GetUserID() string {
 	return a.UserDetails.UserID
@@ -51,3 +55,17 @@ func (a *AuthDetails) DeviceUUID() uuid.UUID {
 	id, _ := a.GetDeviceAsUUID()
 	return id
 }
+
+//-------------------------------------\\
+
+// GetExpirationTime -> the ExpireDate, or CreatedDate + TTL (seconds) if it's missing
+// It's zero if the token doesn't expire
+func (a *AuthTokenDetails) GetExpirationTime() time.Time {
+	if !a.ExpireDate.IsZero() {
+		return a.ExpireDate
+	}
+	if a.TTL > 0 && !a.CreatedDate.IsZero() {
+		return a.CreatedDate.Add(time.Duration(a.TTL) * time.Second)
+	}
+	return time.Time{}
+}
@@ -50,11 +50,26 @@ func (a *Auth) GetAuthTypeKeyName() string {
 	return a.authTypeKeyName
 }
 
-func (a *Auth) SetAuthDetails(details *AuthDetails) {
+// SetAuthDetails -> returns false if the request has been rejected when the details were set (ex: a session
+// limit has been exceeded), the response has been written and the context aborted, the caller should stop
+func (a *Auth) SetAuthDetails(details *AuthDetails) bool {
 	// Saving the authentication details into Http Connection Context
 	a.C.Set(HttpContextAuthDetailsKey, details)
+	// Notify whoever is interested in the details (ex: the clients registry)
+	if onAuthDetails, ok := a.C.Get(HttpContextOnAuthDetailsKey); ok && onAuthDetails != nil {
+		if !onAuthDetails.(OnAuthDetails)(details) {
+			a.C.Abort()
+			return false
+		}
+	}
 	//ctx := context.WithValue(a.C.Request.Context(), HttpContextAuthDetailsKey, details)
 	//a.C.Request = a.C.Request.WithContext(ctx)
+	return true
+}
+
+// IsAborted -> the request has been aborted (ex: rejected by SetAuthDetails), nothing else should be written
+func (a *Auth) IsAborted() bool {
+	return a.C.IsAborted()
 }
 
 func (a *Auth) Abort(code int, httpCode int, msg string) {
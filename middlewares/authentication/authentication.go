@@ -14,6 +14,13 @@ type OnTokenInvalid func(*Auth)
 
 const HttpContextAuthDetailsKey = "AUTH_DETAILS"
 
+// HttpContextOnAuthDetailsKey -> here can be stored an OnAuthDetails callback, it's called when the details are set
+// (the server uses it to re-index the client)
+const HttpContextOnAuthDetailsKey = "ON_AUTH_DETAILS"
+
+// OnAuthDetails -> returns false if the request has been rejected (ex: a session limit), the context is aborted
+type OnAuthDetails func(details *AuthDetails) bool
+
 const ByHeader = 1
 const ByGetParam = 2
 const ByCookie = 3
@@ -0,0 +1,51 @@
+package status_auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware -> basic authentication against the accounts, they are taken on each request,
+// in this way they can be changed at runtime
+func Middleware(getAccounts func() []Account) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, password, ok := c.Request.BasicAuth()
+		if ok {
+			for _, account := range getAccounts() {
+				if account.Username != username {
+					continue
+				}
+				if VerifyPassword(account.Password, password) {
+					c.Set(HttpContextStatusAccountKey, account)
+					c.Next()
+					return
+				}
+				break
+			}
+		}
+		c.Header("WWW-Authenticate", "Basic realm=\"Authorization Required\"")
+		c.AbortWithStatus(http.StatusUnauthorized)
+	}
+}
+
+// RequireScope -> should be used after Middleware, it rejects the accounts which don't have the scope
+func RequireScope(scope Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		account := GetAccountFromCtx(c)
+		if account == nil || !account.Scope.Allows(scope) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.Next()
+	}
+}
+
+func GetAccountFromCtx(c *gin.Context) *Account {
+	account, ifExists := c.Get(HttpContextStatusAccountKey)
+	if !ifExists || account == nil {
+		return nil
+	}
+	a := account.(Account)
+	return &a
+}
@@ -0,0 +1,129 @@
+package status_auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/kyaxcorp/go-helper/errors2/define"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	hashTypePlain    = ""
+	hashTypeBcrypt   = "bcrypt"
+	hashTypeArgon2id = "argon2id"
+	hashTypeArgon2i  = "argon2i"
+)
+
+// hashType -> detects the type of the stored password by its prefix
+func hashType(stored string) string {
+	switch {
+	case strings.HasPrefix(stored, "$2a$"),
+		strings.HasPrefix(stored, "$2b$"),
+		strings.HasPrefix(stored, "$2y$"):
+		return hashTypeBcrypt
+	case strings.HasPrefix(stored, "$argon2id$"):
+		return hashTypeArgon2id
+	case strings.HasPrefix(stored, "$argon2i$"):
+		return hashTypeArgon2i
+	default:
+		return hashTypePlain
+	}
+}
+
+// IsHashed -> if the stored password is a bcrypt or argon2 hash
+func IsHashed(stored string) bool {
+	return hashType(stored) != hashTypePlain
+}
+
+// CheckPassword -> checks that the stored password (if it's a hash) has a valid format
+func CheckPassword(stored string) error {
+	switch hashType(stored) {
+	case hashTypeBcrypt:
+		if _, _err := bcrypt.Cost([]byte(stored)); _err != nil {
+			return define.Err(0, "invalid bcrypt hash", _err.Error())
+		}
+	case hashTypeArgon2id, hashTypeArgon2i:
+		if _, _err := parseArgon2(stored); _err != nil {
+			return _err
+		}
+	}
+	return nil
+}
+
+// VerifyPassword -> compares the given password with the stored one, which can be plain, bcrypt or argon2 (PHC format)
+func VerifyPassword(stored string, given string) bool {
+	switch hashType(stored) {
+	case hashTypeBcrypt:
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(given)) == nil
+	case hashTypeArgon2id, hashTypeArgon2i:
+		h, _err := parseArgon2(stored)
+		if _err != nil {
+			return false
+		}
+		return subtle.ConstantTimeCompare(h.key(given), h.hash) == 1
+	default:
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(given)) == 1
+	}
+}
+
+type argon2Hash struct {
+	variant string
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	hash    []byte
+}
+
+func (h *argon2Hash) key(password string) []byte {
+	if h.variant == hashTypeArgon2i {
+		return argon2.Key([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.hash)))
+	}
+	return argon2.IDKey([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.hash)))
+}
+
+// parseArgon2 -> parses the PHC string format: $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+func parseArgon2(stored string) (*argon2Hash, error) {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 {
+		return nil, define.Err(0, "invalid argon2 hash format")
+	}
+
+	var version int
+	if _, _err := fmt.Sscanf(parts[2], "v=%d", &version); _err != nil || version != argon2.Version {
+		return nil, define.Err(0, "unsupported argon2 version")
+	}
+
+	h := &argon2Hash{variant: parts[1]}
+	if _, _err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); _err != nil {
+		return nil, define.Err(0, "invalid argon2 params", _err.Error())
+	}
+	// The argon2 package panics on these values
+	if h.time < 1 {
+		return nil, define.Err(0, "invalid argon2 params", "t should be at least 1")
+	}
+	if h.threads < 1 {
+		return nil, define.Err(0, "invalid argon2 params", "p should be at least 1")
+	}
+	if h.memory < 8*uint32(h.threads) {
+		return nil, define.Err(0, "invalid argon2 params", "m should be at least 8*p")
+	}
+
+	var _err error
+	h.salt, _err = base64.RawStdEncoding.DecodeString(parts[4])
+	if _err != nil {
+		return nil, define.Err(0, "invalid argon2 salt", _err.Error())
+	}
+	if len(h.salt) == 0 {
+		return nil, define.Err(0, "invalid argon2 salt", "salt is empty")
+	}
+	h.hash, _err = base64.RawStdEncoding.DecodeString(parts[5])
+	if _err != nil || len(h.hash) == 0 {
+		return nil, define.Err(0, "invalid argon2 hash")
+	}
+	return h, nil
+}
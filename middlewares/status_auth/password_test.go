@@ -0,0 +1,79 @@
+package status_auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "s3cret-pass"
+
+// argon2PHC -> the PHC string of the password, the params are written as given
+func argon2PHC(variant string, params string, salt string, password string) string {
+	key := argon2.IDKey([]byte(password), []byte(salt), 1, 64, 1, 32)
+	if variant == hashTypeArgon2i {
+		key = argon2.Key([]byte(password), []byte(salt), 1, 64, 1, 32)
+	}
+	return fmt.Sprintf(
+		"$%s$v=%d$%s$%s$%s",
+		variant, argon2.Version, params,
+		base64.RawStdEncoding.EncodeToString([]byte(salt)),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func TestPasswordHashes(t *testing.T) {
+	bcryptHash, _err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if _err != nil {
+		t.Fatal(_err)
+	}
+
+	tests := []struct {
+		name   string
+		stored string
+		// invalid -> a part of the CheckPassword error, empty if the hash is valid
+		invalid string
+	}{
+		{name: "plain", stored: testPassword},
+		{name: "bcrypt", stored: string(bcryptHash)},
+		{name: "invalid bcrypt", stored: "$2a$10$short", invalid: "invalid bcrypt hash"},
+		{name: "argon2id", stored: argon2PHC(hashTypeArgon2id, "m=64,t=1,p=1", "somesalt", testPassword)},
+		{name: "argon2i", stored: argon2PHC(hashTypeArgon2i, "m=64,t=1,p=1", "somesalt", testPassword)},
+		{name: "zero time", stored: argon2PHC(hashTypeArgon2id, "m=64,t=0,p=1", "somesalt", testPassword), invalid: "t should be at least 1"},
+		{name: "zero threads", stored: argon2PHC(hashTypeArgon2id, "m=64,t=1,p=0", "somesalt", testPassword), invalid: "p should be at least 1"},
+		{name: "memory too low", stored: argon2PHC(hashTypeArgon2id, "m=15,t=1,p=2", "somesalt", testPassword), invalid: "m should be at least 8*p"},
+		{name: "zero threads argon2i", stored: argon2PHC(hashTypeArgon2i, "m=64,t=1,p=0", "somesalt", testPassword), invalid: "p should be at least 1"},
+		{name: "empty salt", stored: argon2PHC(hashTypeArgon2id, "m=64,t=1,p=1", "", testPassword), invalid: "salt is empty"},
+		{name: "unsupported version", stored: strings.Replace(argon2PHC(hashTypeArgon2id, "m=64,t=1,p=1", "somesalt", testPassword), "v=19", "v=16", 1), invalid: "unsupported argon2 version"},
+		{name: "missing parts", stored: "$argon2id$v=19$m=64,t=1,p=1", invalid: "invalid argon2 hash format"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_err := CheckPassword(test.stored)
+			if test.invalid == "" {
+				if _err != nil {
+					t.Fatalf("expected a valid hash, got: %v", _err)
+				}
+				if !VerifyPassword(test.stored, testPassword) {
+					t.Error("the right password has been refused")
+				}
+				if VerifyPassword(test.stored, "wrong") {
+					t.Error("a wrong password has been accepted")
+				}
+				return
+			}
+			if _err == nil || !strings.Contains(_err.Error(), test.invalid) {
+				t.Fatalf("expected an error containing %q, got: %v", test.invalid, _err)
+			}
+			// An invalid hash never matches, and it shouldn't panic
+			if VerifyPassword(test.stored, testPassword) {
+				t.Error("an invalid hash has accepted the password")
+			}
+		})
+	}
+}
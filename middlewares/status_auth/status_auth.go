@@ -0,0 +1,31 @@
+package status_auth
+
+type Scope string
+
+// ScopeReadOnly -> can read the general status (server, nr of clients, system status)
+const ScopeReadOnly Scope = "read_only"
+
+// ScopeAdmin -> can also read the sensitive data (clients, config...) and execute actions
+const ScopeAdmin Scope = "admin"
+
+const HttpContextStatusAccountKey = "STATUS_ACCOUNT"
+
+// IsValidScope -> checks if the scope is one of the known ones
+func IsValidScope(scope Scope) bool {
+	return scope == ScopeReadOnly || scope == ScopeAdmin
+}
+
+// Allows -> if the account scope includes the required scope
+func (s Scope) Allows(required Scope) bool {
+	if s == ScopeAdmin {
+		return true
+	}
+	return s == required
+}
+
+type Account struct {
+	Username string
+	// Password -> plain, bcrypt or argon2 (PHC format) hash
+	Password string
+	Scope    Scope
+}
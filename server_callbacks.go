@@ -12,7 +12,7 @@ func (s *Server) OnStart(name string, callback OnStart) bool {
 	return true
 }
 
-func (s *Server) OnBeforeStart(name string, callback OnStart) bool {
+func (s *Server) OnBeforeStart(name string, callback OnBeforeStart) bool {
 	if !function.IsCallable(callback) || name == "" {
 		return false
 	}
@@ -20,7 +20,7 @@ func (s *Server) OnBeforeStart(name string, callback OnStart) bool {
 	return true
 }
 
-func (s *Server) OnStarted(name string, callback OnStart) bool {
+func (s *Server) OnStarted(name string, callback OnStarted) bool {
 	if !function.IsCallable(callback) || name == "" {
 		return false
 	}
@@ -40,7 +40,7 @@ func (s *Server) OnStartedRemove(name string) {
 	s.onStarted.Del(name)
 }
 
-func (s *Server) OnBeforeStop(name string, callback OnStop) bool {
+func (s *Server) OnBeforeStop(name string, callback OnBeforeStop) bool {
 	if !function.IsCallable(callback) || name == "" {
 		return false
 	}
@@ -56,7 +56,7 @@ func (s *Server) OnStop(name string, callback OnStop) bool {
 	return true
 }
 
-func (s *Server) OnStopped(name string, callback OnStop) bool {
+func (s *Server) OnStopped(name string, callback OnStopped) bool {
 	if !function.IsCallable(callback) || name == "" {
 		return false
 	}
@@ -99,3 +99,123 @@ func (s *Server) OnResponse(name string, callback OnResponse) bool {
 func (s *Server) OnResponseRemove(name string) {
 	s.onResponse.Del(name)
 }
+
+func (s *Server) OnClientDisconnected(name string, callback OnClientDisconnected) bool {
+	if !function.IsCallable(callback) || name == "" {
+		return false
+	}
+	s.onClientDisconnected.Set(name, callback)
+	return true
+}
+
+func (s *Server) OnClientDisconnectedRemove(name string) {
+	s.onClientDisconnected.Del(name)
+}
+
+func (s *Server) OnWebSocketMessage(name string, callback OnWebSocketMessage) bool {
+	if !function.IsCallable(callback) || name == "" {
+		return false
+	}
+	s.onWebSocketMessage.Set(name, callback)
+	return true
+}
+
+func (s *Server) OnWebSocketMessageRemove(name string) {
+	s.onWebSocketMessage.Del(name)
+}
+
+func (s *Server) OnBeforeReload(name string, callback OnBeforeReload) bool {
+	if !function.IsCallable(callback) || name == "" {
+		return false
+	}
+	s.onBeforeReload.Set(name, callback)
+	return true
+}
+
+func (s *Server) OnReloaded(name string, callback OnReloaded) bool {
+	if !function.IsCallable(callback) || name == "" {
+		return false
+	}
+	s.onReloaded.Set(name, callback)
+	return true
+}
+
+func (s *Server) OnReloadFailed(name string, callback OnReloadFailed) bool {
+	if !function.IsCallable(callback) || name == "" {
+		return false
+	}
+	s.onReloadFailed.Set(name, callback)
+	return true
+}
+
+func (s *Server) OnBeforeReloadRemove(name string) {
+	s.onBeforeReload.Del(name)
+}
+
+func (s *Server) OnReloadedRemove(name string) {
+	s.onReloaded.Del(name)
+}
+
+func (s *Server) OnReloadFailedRemove(name string) {
+	s.onReloadFailed.Del(name)
+}
+
+func (s *Server) OnUserOnline(name string, callback OnUserOnline) bool {
+	if !function.IsCallable(callback) || name == "" {
+		return false
+	}
+	s.onUserOnline.Set(name, callback)
+	return true
+}
+
+func (s *Server) OnUserOffline(name string, callback OnUserOffline) bool {
+	if !function.IsCallable(callback) || name == "" {
+		return false
+	}
+	s.onUserOffline.Set(name, callback)
+	return true
+}
+
+func (s *Server) OnDeviceOnline(name string, callback OnDeviceOnline) bool {
+	if !function.IsCallable(callback) || name == "" {
+		return false
+	}
+	s.onDeviceOnline.Set(name, callback)
+	return true
+}
+
+func (s *Server) OnDeviceOffline(name string, callback OnDeviceOffline) bool {
+	if !function.IsCallable(callback) || name == "" {
+		return false
+	}
+	s.onDeviceOffline.Set(name, callback)
+	return true
+}
+
+func (s *Server) OnUserOnlineRemove(name string) {
+	s.onUserOnline.Del(name)
+}
+
+func (s *Server) OnUserOfflineRemove(name string) {
+	s.onUserOffline.Del(name)
+}
+
+func (s *Server) OnDeviceOnlineRemove(name string) {
+	s.onDeviceOnline.Del(name)
+}
+
+func (s *Server) OnDeviceOfflineRemove(name string) {
+	s.onDeviceOffline.Del(name)
+}
+
+func (s *Server) OnTokenExpired(name string, callback OnTokenExpired) bool {
+	if !function.IsCallable(callback) || name == "" {
+		return false
+	}
+	s.onTokenExpired.Set(name, callback)
+	return true
+}
+
+func (s *Server) OnTokenExpiredRemove(name string) {
+	s.onTokenExpired.Del(name)
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"crypto/tls"
+
+	"github.com/kyaxcorp/go-helper/errors2/define"
+)
+
+// getCertificate -> it's called on each tls handshake, in this way the certificate can be swapped at runtime
+func (s *Server) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert := s.getCertificateSnapshot()
+	if cert == nil {
+		return nil, define.Err(0, "ssl certificate is not loaded")
+	}
+	return cert, nil
+}
+
+func (s *Server) getCertificateSnapshot() *tls.Certificate {
+	s.certLock.RLock()
+	defer s.certLock.RUnlock()
+	return s.certificate
+}
+
+// loadCertificate -> loads the certificate from the configured paths
+func (s *Server) loadCertificate() error {
+	s.certLock.Lock()
+	defer s.certLock.Unlock()
+	cert, _err := tls.LoadX509KeyPair(s.sslCertPath, s.sslKeyPath)
+	if _err != nil {
+		return define.Err(0, "failed to load certificates", _err.Error())
+	}
+	s.certificate = &cert
+	return nil
+}
+
+// SetCertificates -> swaps the certificate and key, the new ones are used by the next tls handshakes
+// If the new pair can't be loaded, the current one remains active
+func (s *Server) SetCertificates(certPath string, keyPath string) error {
+	cert, _err := tls.LoadX509KeyPair(certPath, keyPath)
+	if _err != nil {
+		return define.Err(0, "failed to load certificates", _err.Error())
+	}
+
+	s.certLock.Lock()
+	s.sslCertPath = certPath
+	s.sslKeyPath = keyPath
+	s.certificate = &cert
+	s.certLock.Unlock()
+
+	s.LInfoF("SetCertificates").
+		Str("ssl_cert_file_path", certPath).
+		Str("ssl_key_file_path", keyPath).
+		Msg("certificates have been swapped")
+	return nil
+}
@@ -5,7 +5,9 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kyaxcorp/go-helper/errors2/define"
 	"github.com/kyaxcorp/go-http/middlewares/authentication"
+	"github.com/rs/zerolog"
 )
 
 func (c *Client) GetConnectTime() time.Time {
@@ -13,8 +15,12 @@ func (c *Client) GetConnectTime() time.Time {
 }
 
 func (c *Client) GetConnectedTimeSeconds() int64 {
-	// TODO : calculate
-	return 1
+	return int64(c.GetConnectedDuration().Seconds())
+}
+
+// GetConnectedDuration -> since when the client has connected
+func (c *Client) GetConnectedDuration() time.Duration {
+	return time.Since(c.connectTime)
 }
 
 func (c *Client) setAsClosed() {
@@ -22,27 +28,10 @@ func (c *Client) setAsClosed() {
 	c.isClosed.True()
 }
 
-// TODO: review this function!
-// DisconnectGracefully -> set 0 and "" for default values!
-/*func (c *Client) DisconnectGracefully(code uint16, message string) {
-	// We send to the client that we want to close the connection!
-	// And we should receive response back, and after that the disconnect will be called!
-
-	c.setAsClosed()
-
-	if code > 0 {
-		c.closeCode = code
-	}
-	if message != "" && len(message) > 0 {
-		c.closeMessage = message
-	}
-	// send through channel!
-	c.send <- []byte(strconv.Itoa(msg.Close))
-}*/
-
-// TODO: review this function!
-// Disconnect the client forcefully!!
-/*func (c *Client) Disconnect() error {
+// Disconnect -> cancels the request context and closes the hijacked/streaming connection of the client
+// The handlers should stop when the request context is done (c.Request.Context())
+// The reason is passed to the OnClientDisconnected callbacks
+func (c *Client) Disconnect(reason string) error {
 	info := func() *zerolog.Event {
 		return c.LInfoF("Disconnect")
 	}
@@ -53,24 +42,57 @@ func (c *Client) setAsClosed() {
 	info().Msg("calling...")
 	defer info().Msg("leaving...")
 
-	if c.IsDisconnecting() {
+	if c.remote != nil {
+		return define.Err(0, "the client is connected to another node", c.remote.NodeID)
+	}
+	if c.isDisconnecting.IfFalseSetTrue() {
 		warn().Msg("already disconnecting...")
 		return nil
 	}
-	c.setAsClosed()
 
-	// On Close callback
-	c.server.onClose.Scan(func(k string, v interface{}) {
-		v.(OnClose)(c, c.server)
+	c.disconnectLock.Lock()
+	c.closeMessage = reason
+	closers := c.closers
+	c.closers = nil
+	c.disconnectLock.Unlock()
+
+	info().Str("reason", reason).Msg("closing the client connection...")
+	if c.cancel != nil {
+		c.cancel()
+	}
+	var _err error
+	for _, closer := range closers {
+		if closeErr := closer(); closeErr != nil && _err == nil {
+			_err = closeErr
+		}
+	}
+
+	// On Disconnected callback
+	c.server.onClientDisconnected.Scan(func(k string, v interface{}) {
+		go v.(OnClientDisconnected)(c, reason, c.server)
 	})
+	return _err
+}
 
-	info().Msg("closing the client connection...")
+// addCloser -> the closer will be called on Disconnect
+// If the client is already disconnecting, it's called immediately
+func (c *Client) addCloser(closer func() error) {
+	c.disconnectLock.Lock()
+	if !c.isDisconnecting.Get() {
+		c.closers = append(c.closers, closer)
+		c.disconnectLock.Unlock()
+		return
+	}
+	c.disconnectLock.Unlock()
+	_ = closer()
+}
 
-	c.writeTicker.Stop()
-	c.isDisconnecting.True()
-	// This is a force Close!
-	return c.conn.Close()
-}*/
+// GetDisconnectReason -> the reason given to Disconnect
+func (c *Client) GetDisconnectReason() string {
+	c.disconnectLock.Lock()
+	defer c.disconnectLock.Unlock()
+	return c.closeMessage
+}
 
 func (c *Client) IsDisconnecting() bool {
 	return c.isDisconnecting.Get()
@@ -85,19 +107,19 @@ func (c *Client) GetHttpContext() *gin.Context {
 }
 
 func (c *Client) GetDeviceID() string {
-	return c.authDetails.DeviceDetails.DeviceID
+	return c.GetAuthDetails().DeviceDetails.DeviceID
 }
 
 func (c *Client) GetDeviceUUID() string {
-	return c.authDetails.DeviceDetails.DeviceUUID
+	return c.GetAuthDetails().DeviceDetails.DeviceUUID
 }
 
 func (c *Client) GetUserID() string {
-	return c.authDetails.UserDetails.UserID
+	return c.GetAuthDetails().UserDetails.UserID
 }
 
 func (c *Client) GetAuthToken() string {
-	return c.authDetails.AuthTokenDetails.Token
+	return c.GetAuthDetails().AuthTokenDetails.Token
 }
 
 /*func (c *Client) GetAuthTokenID() uint64 {
@@ -117,13 +139,124 @@ func (c *Client) GetRequestPath() string {
 }
 
 func (c *Client) GetTokenExpirationTime() time.Time {
-	return c.authDetails.AuthTokenDetails.ExpireDate
+	return c.GetAuthDetails().AuthTokenDetails.GetExpirationTime()
 }
 
 func (c *Client) GetAuthDetails() *authentication.AuthDetails {
+	c.detailsLock.RLock()
+	defer c.detailsLock.RUnlock()
 	return c.authDetails
 }
 
+// setAuthDetails -> the indexes should be updated by the caller (updateClientAuthDetails)
+func (c *Client) setAuthDetails(details *authentication.AuthDetails) {
+	c.detailsLock.Lock()
+	c.authDetails = details
+	c.detailsLock.Unlock()
+}
+
+// startSending -> creates the send queue, from now on the messages of the kind can be queued for the client
+func (c *Client) startSending(kind sendKind, bufferSize int) chan []byte {
+	c.sendLock.Lock()
+	c.send = make(chan []byte, bufferSize)
+	c.sendKind = kind
+	send := c.send
+	clientKind := ClientKindSSE
+	if kind == sendKindWebSocket {
+		clientKind = ClientKindWebSocket
+	}
+	becameLongLived := c.setKind(clientKind)
+	c.sendLock.Unlock()
+
+	if becameLongLived {
+		c.longLived()
+	}
+	return send
+}
+
+// stopSending -> the messages are no more queued for the client
+func (c *Client) stopSending() {
+	c.sendLock.Lock()
+	c.send = nil
+	c.sendKind = sendKindNone
+	c.sendLock.Unlock()
+}
+
+// IsSending -> checks if the client has a send queue (it's a streaming/websocket client)
+func (c *Client) IsSending() bool {
+	c.sendLock.RLock()
+	defer c.sendLock.RUnlock()
+	return c.send != nil
+}
+
+// GetKind -> how the client is connected, a request becomes a streaming/websocket/hijacked client
+// from the handler
+func (c *Client) GetKind() ClientKind {
+	c.sendLock.RLock()
+	defer c.sendLock.RUnlock()
+	if c.kind == "" {
+		return ClientKindRequest
+	}
+	return c.kind
+}
+
+// IsLongLived -> checks if it's a streaming (SSE), websocket or hijacked client
+func (c *Client) IsLongLived() bool {
+	return c.GetKind() != ClientKindRequest
+}
+
+// setKind -> returns true if the client has become long-lived
+// The programmer should hold sendLock before!
+func (c *Client) setKind(kind ClientKind) bool {
+	wasLongLived := c.kind != "" && c.kind != ClientKindRequest
+	// The websocket connections are hijacked before sending, the websocket kind is kept
+	if kind == ClientKindHijacked && wasLongLived {
+		return false
+	}
+	c.kind = kind
+	return !wasLongLived && kind != ClientKindRequest
+}
+
+// longLived -> the client has become long-lived, from now on the registry knows about it
+func (c *Client) longLived() {
+	if c.server != nil {
+		c.server.registryRegister(c)
+	}
+}
+
+// enqueue -> puts the message in the send queue without blocking
+// It returns false if the client doesn't receive this kind of messages (SSE/WebSocket)
+// If the queue is full, the client is a slow consumer and it's disconnected
+func (c *Client) enqueue(kind sendKind, message []byte) bool {
+	c.sendLock.RLock()
+	defer c.sendLock.RUnlock()
+	if c.send == nil || c.sendKind != kind {
+		return false
+	}
+	c.messageQueued()
+	select {
+	case c.send <- message:
+		return true
+	default:
+		c.messageFailed()
+		c.LWarnF("enqueue").Msg("send queue is full, disconnecting the slow consumer...")
+		go c.Disconnect(SlowConsumerReason)
+		return false
+	}
+}
+
+func (c *Client) GetNrOfSentMessages() uint64 {
+	return c.nrOfSentMessages.Get()
+}
+
+func (c *Client) GetNrOfSentFailedMessages() uint64 {
+	return c.nrOfSentFailedMessages.Get()
+}
+
+func (c *Client) GetNrOfSentSuccessMessages() uint64 {
+	return c.nrOfSentSuccessMessages.Get()
+}
+
 // This generates an unique ID for the Message that will be sent!
 func (c *Client) genPayloadID() string {
 
@@ -144,6 +277,10 @@ func (c *Client) genPayloadID() string {
 func (c *Client) Set(key string, value interface{}) *Client {
 	//c.customData[key] = value
 	c.customData.Set(key, value)
+	// The user-defined indexes watching the key are updated
+	if c.server != nil && c.server.c != nil {
+		c.server.c.customDataChanged(c, key)
+	}
 	return c
 }
 
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"github.com/kyaxcorp/go-helper/errors2/define"
+)
+
+// ClientIndexExtractor -> returns the keys under which the client is indexed
+// It's called while the shard of the client is locked, so it should only read the client (Get, GetUserID...)
+type ClientIndexExtractor func(client *Client) []string
+
+// customClientIndex -> a user-defined index
+type customClientIndex struct {
+	name      string
+	extractor ClientIndexExtractor
+	// watchedKeys -> the custom data keys which trigger the re-indexing, if empty any key triggers it
+	watchedKeys map[string]bool
+}
+
+func (i *customClientIndex) isWatching(key string) bool {
+	if len(i.watchedKeys) == 0 {
+		return true
+	}
+	return i.watchedKeys[key]
+}
+
+// extractKeys -> the unique non-empty keys of the client
+func (i *customClientIndex) extractKeys(client *Client) []string {
+	extracted := i.extractor(client)
+	keys := make([]string, 0, len(extracted))
+	seen := make(map[string]bool, len(extracted))
+	for _, key := range extracted {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// getCustomIndexes -> the indexes watching the custom data key, all of them if the key is empty
+func (c *clientsData) getCustomIndexes(key string) []*customClientIndex {
+	c.customIndexesLock.RLock()
+	defer c.customIndexesLock.RUnlock()
+	indexes := make([]*customClientIndex, 0, len(c.customIndexes))
+	for _, index := range c.customIndexes {
+		if key == "" || index.isWatching(key) {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+func (c *Client) getIndexedKeys(indexName string) []string {
+	c.indexedKeysLock.RLock()
+	defer c.indexedKeysLock.RUnlock()
+	return c.indexedKeys[indexName]
+}
+
+func (c *Client) setIndexedKeys(indexName string, keys []string) {
+	c.indexedKeysLock.Lock()
+	defer c.indexedKeysLock.Unlock()
+	if len(keys) == 0 {
+		delete(c.indexedKeys, indexName)
+		return
+	}
+	if c.indexedKeys == nil {
+		c.indexedKeys = make(map[string][]string)
+	}
+	c.indexedKeys[indexName] = keys
+}
+
+// hasIndexedKey -> checks if the client is indexed under the key
+func (c *Client) hasIndexedKey(indexName string, key string) bool {
+	for _, indexedKey := range c.getIndexedKeys(indexName) {
+		if indexedKey == key {
+			return true
+		}
+	}
+	return false
+}
+
+// customIndexChanges -> replaces the keys of the client in the indexes
+// The programmer should handle the lock of the client's shard before!
+func customIndexChanges(changes []indexChange, client *Client, indexes []*customClientIndex) []indexChange {
+	for _, index := range indexes {
+		keys := index.extractKeys(client)
+		getIndex := indexCustomForUpdate(index.name)
+		for _, key := range client.getIndexedKeys(index.name) {
+			changes = append(changes, indexChange{getIndex: getIndex, key: key})
+		}
+		for _, key := range keys {
+			changes = append(changes, indexChange{getIndex: getIndex, key: key, add: true})
+		}
+		client.setIndexedKeys(index.name, keys)
+	}
+	return changes
+}
+
+// unsetCustomIndexChanges -> removes the client from all the indexes
+// The programmer should handle the lock of the client's shard before!
+func unsetCustomIndexChanges(changes []indexChange, client *Client) []indexChange {
+	client.indexedKeysLock.Lock()
+	indexedKeys := client.indexedKeys
+	client.indexedKeys = nil
+	client.indexedKeysLock.Unlock()
+	for indexName, keys := range indexedKeys {
+		getIndex := indexCustom(indexName)
+		for _, key := range keys {
+			changes = append(changes, indexChange{getIndex: getIndex, key: key})
+		}
+	}
+	return changes
+}
+
+// customDataChanged -> re-indexes the client in the indexes watching the key
+func (c *clientsData) customDataChanged(client *Client, key string) {
+	indexes := c.getCustomIndexes(key)
+	if len(indexes) == 0 {
+		return
+	}
+	shard := c.getShard(client.connectionID)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	if !shard.clients[client] || !c.enableIndexing {
+		return
+	}
+	c.keys.update(client, customIndexChanges(nil, client, indexes))
+}
+
+// RegisterClientIndex -> adds an index on the keys returned by the extractor (usually from the custom data)
+// The clients are re-indexed when they register, and when Client.Set is called with one of the watched keys
+// (with any key if there are no watched keys)
+// The index can be searched by GetClientsByIndex, FindClientsFilter.Indexes or QueryIndex
+func (c *clientsData) RegisterClientIndex(name string, extractor ClientIndexExtractor, watchedKeys ...string) error {
+	if name == "" {
+		return define.Err(0, "client index name is empty")
+	}
+	if extractor == nil {
+		return define.Err(0, "client index extractor is nil", name)
+	}
+	index := &customClientIndex{
+		name:        name,
+		extractor:   extractor,
+		watchedKeys: make(map[string]bool, len(watchedKeys)),
+	}
+	for _, key := range watchedKeys {
+		index.watchedKeys[key] = true
+	}
+
+	c.customIndexesLock.Lock()
+	if _, ok := c.customIndexes[name]; ok {
+		c.customIndexesLock.Unlock()
+		return define.Err(0, "client index already registered", name)
+	}
+	c.customIndexes[name] = index
+	c.customIndexesLock.Unlock()
+
+	// Index the clients which are already registered
+	// The ones registered meanwhile are indexed twice, that's ok
+	if !c.enableIndexing {
+		return nil
+	}
+	for _, shard := range c.shards {
+		shard.lock.Lock()
+		for client := range shard.clients {
+			c.keys.update(client, customIndexChanges(nil, client, []*customClientIndex{index}))
+		}
+		shard.lock.Unlock()
+	}
+	return nil
+}
+
+// GetClientsByIndex -> returns the clients indexed under the key by the registered index
+func (c *clientsData) GetClientsByIndex(name string, key string) map[uint64]*Client {
+	return c.getClientsByIndex(indexCustom(name), key)
+}
+
+func (s *Server) RegisterClientIndex(name string, extractor ClientIndexExtractor, watchedKeys ...string) error {
+	return s.c.RegisterClientIndex(name, extractor, watchedKeys...)
+}
+
+func (s *Server) GetClientsByIndex(name string, key string) map[uint64]*Client {
+	return s.c.GetClientsByIndex(name, key)
+}
+
+// QueryIndex -> matches the clients indexed under one of the keys by the registered index
+func QueryIndex(name string, keys ...string) *ClientQuery {
+	return &ClientQuery{
+		match: func(client *Client) bool {
+			for _, key := range keys {
+				if client.hasIndexedKey(name, key) {
+					return true
+				}
+			}
+			return false
+		},
+		lookup: func(c *clientsData) map[uint64]*Client {
+			clients := make(map[uint64]*Client)
+			for _, key := range keys {
+				copyClientsInto(clients, c.GetClientsByIndex(name, key))
+			}
+			return clients
+		},
+	}
+}
@@ -0,0 +1,237 @@
+//go:build unix
+
+package server
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/kyaxcorp/go-helper/array"
+)
+
+// legacyPrepareFilter -> the previous version, a goroutine for each exceptions map
+func legacyPrepareFilter(filter *FindClientsFilter) *FindClientsFilter {
+	var awaitGroup sync.WaitGroup
+	awaitGroup.Add(6)
+	build := func(f func()) {
+		go func() {
+			defer awaitGroup.Done()
+			f()
+		}()
+	}
+	build(func() {
+		if len(filter.ExceptConnections) > 0 {
+			filter.isExceptConnections = true
+			filter.exceptConnectionsMap = array.ConvUint64ValuesToMapKey(filter.ExceptConnections)
+		}
+	})
+	build(func() {
+		if len(filter.ExceptUsers) > 0 {
+			filter.isExceptUsers = true
+			filter.exceptUsersMap = array.ConvStringValuesToMapKey(filter.ExceptUsers)
+		}
+	})
+	build(func() {
+		if len(filter.ExceptDevices) > 0 {
+			filter.isExceptDevices = true
+			filter.exceptDevicesMap = array.ConvStringValuesToMapKey(filter.ExceptDevices)
+		}
+	})
+	build(func() {
+		if len(filter.ExceptAuthTokens) > 0 {
+			filter.isExceptAuthTokens = true
+			filter.exceptAuthTokensMap = array.ConvStringValuesToMapKey(filter.ExceptAuthTokens)
+		}
+	})
+	build(func() {
+		if len(filter.ExceptIPAddresses) > 0 {
+			filter.isExceptIPAddresses = true
+			filter.exceptIPAddressesMap = array.ConvStringValuesToMapKey(filter.ExceptIPAddresses)
+		}
+	})
+	build(func() {
+		if len(filter.ExceptRequestPaths) > 0 {
+			filter.isExceptRequestPaths = true
+			filter.exceptRequestPathsMap = array.ConvStringValuesToMapKey(filter.ExceptRequestPaths)
+		}
+	})
+	awaitGroup.Wait()
+	return filter
+}
+
+// legacyGetClientsByFilter -> the previous version, a goroutine for each searched index and a busy loop
+// waiting for their results (the break of the default branch leaves only the select)
+func legacyGetClientsByFilter(c *clientsData, filter FindClientsFilter) map[uint64]*Client {
+	var nrOfLaunchedSearches = 0
+	var awaitGroup sync.WaitGroup
+	legacyPrepareFilter(&filter)
+	foundClientsChan := make(chan map[uint64]*Client)
+
+	search := func(keys []string, exceptMap map[string]int, lookup func(key string) map[uint64]*Client) {
+		if len(keys) == 0 {
+			return
+		}
+		awaitGroup.Add(1)
+		nrOfLaunchedSearches++
+		go func() {
+			defer awaitGroup.Done()
+			local := make(map[uint64]*Client)
+			for _, key := range keys {
+				if key == "" {
+					continue
+				}
+				if _, ok := exceptMap[key]; ok {
+					continue
+				}
+				for connectionID, client := range lookup(key) {
+					if _, ok := local[connectionID]; !ok {
+						local[connectionID] = client
+					}
+				}
+			}
+			foundClientsChan <- local
+		}()
+	}
+	search(filter.Users, filter.exceptUsersMap, c.GetClientsByUserID)
+	search(filter.Devices, filter.exceptDevicesMap, c.GetClientsByDeviceID)
+	search(filter.AuthTokens, filter.exceptAuthTokensMap, c.GetClientsByAuthToken)
+	search(filter.IPAddresses, filter.exceptIPAddressesMap, c.GetClientsByIPAddress)
+	search(filter.RequestPaths, filter.exceptRequestPathsMap, c.GetClientsByRequestPath)
+
+	clients := make(map[uint64]*Client)
+	doneAll := make(chan bool)
+	go func() {
+		awaitGroup.Wait()
+		doneAll <- true
+	}()
+
+	finishedAll := false
+	receivedData := 0
+	for {
+		select {
+		case foundClients := <-foundClientsChan:
+			receivedData++
+			for connectionID, client := range foundClients {
+				if _, ok := clients[connectionID]; !ok {
+					clients[connectionID] = client
+				}
+			}
+		case <-doneAll:
+			finishedAll = true
+		default:
+			if receivedData == nrOfLaunchedSearches {
+				break
+			}
+		}
+		if finishedAll && receivedData == nrOfLaunchedSearches {
+			break
+		}
+	}
+	return clients
+}
+
+// benchmarkFilter -> searches 4 indexes, with exceptions
+func benchmarkFilter(i int, size int) FindClientsFilter {
+	nrOfUsers := size / clientsPerUser
+	user := 1 + i%nrOfUsers
+	return FindClientsFilter{
+		Users:             []string{"user-" + strconv.Itoa(user), "user-" + strconv.Itoa(1+(user+1)%nrOfUsers)},
+		Devices:           []string{"device-" + strconv.Itoa(1+i%size)},
+		AuthTokens:        []string{"token-" + strconv.Itoa(1+(i+7)%size)},
+		IPAddresses:       []string{"10.0.255.1"},
+		ExceptConnections: []uint64{uint64(user * clientsPerUser)},
+		ExceptUsers:       []string{"user-0"},
+	}
+}
+
+// processCPUTime -> the user + system CPU time used by the process
+func processCPUTime(b *testing.B) time.Duration {
+	var usage syscall.Rusage
+	if _err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); _err != nil {
+		b.Fatal(_err)
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+// benchmarkFilterImplementations -> reports the CPU time and the latency percentiles of each call
+func benchmarkFilterImplementations(b *testing.B, run func(c *clientsData, filter FindClientsFilter) map[uint64]*Client) {
+	runForSizes(b, func(b *testing.B, size int) {
+		c := newPopulatedClients(size)
+		latencies := make([]time.Duration, b.N)
+		b.ReportAllocs()
+		b.ResetTimer()
+		cpuStart := processCPUTime(b)
+		for i := 0; i < b.N; i++ {
+			filter := benchmarkFilter(i, size)
+			start := time.Now()
+			if len(run(c, filter)) == 0 {
+				b.Fatal("no clients found")
+			}
+			latencies[i] = time.Since(start)
+		}
+		cpu := processCPUTime(b) - cpuStart
+		b.StopTimer()
+
+		sort.Slice(latencies, func(i, j int) bool {
+			return latencies[i] < latencies[j]
+		})
+		b.ReportMetric(float64(cpu.Nanoseconds())/float64(b.N), "cpu-ns/op")
+		b.ReportMetric(float64(latencies[len(latencies)/2].Nanoseconds()), "p50-ns")
+		b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns")
+	})
+}
+
+// BenchmarkFilterEvaluation -> before (goroutines + busy wait) and after (in the calling goroutine)
+func BenchmarkFilterEvaluation(b *testing.B) {
+	b.Run("before", func(b *testing.B) {
+		benchmarkFilterImplementations(b, legacyGetClientsByFilter)
+	})
+	b.Run("after", func(b *testing.B) {
+		benchmarkFilterImplementations(b, func(c *clientsData, filter FindClientsFilter) map[uint64]*Client {
+			return c.getClientsByFilter(filter)
+		})
+	})
+}
+
+// BenchmarkPrepareFilter -> before (a goroutine for each exceptions map) and after
+func BenchmarkPrepareFilter(b *testing.B) {
+	implementations := []struct {
+		name    string
+		prepare func(filter *FindClientsFilter) *FindClientsFilter
+	}{
+		{"before", legacyPrepareFilter},
+		{"after", prepareFilter},
+	}
+	for _, implementation := range implementations {
+		b.Run(implementation.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				filter := benchmarkFilter(i, 1000)
+				implementation.prepare(&filter)
+			}
+		})
+	}
+}
+
+// TestLegacyFilterEquivalence -> the benchmarks compare implementations giving the same results
+func TestLegacyFilterEquivalence(t *testing.T) {
+	const size = 1000
+	c := newPopulatedClients(size)
+	for i := 0; i < 10; i++ {
+		filter := benchmarkFilter(i*97, size)
+		legacy := legacyGetClientsByFilter(c, filter)
+		current := c.getClientsByFilter(filter)
+		if len(legacy) != len(current) {
+			t.Fatalf("filter %d: the legacy version found %d clients, the current one %d", i, len(legacy), len(current))
+		}
+		for connectionID := range legacy {
+			if current[connectionID] == nil {
+				t.Fatalf("filter %d: client %d is missing from the current result", i, connectionID)
+			}
+		}
+	}
+}
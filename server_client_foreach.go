@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/kyaxcorp/go-helper/errors2/define"
+)
+
+// ClientResult -> the result of the callback for a client
+type ClientResult struct {
+	Client *Client
+	Value  interface{}
+	Err    error
+}
+
+// ForEachClientFunc -> it's called for each client, it should stop when the context is done
+type ForEachClientFunc func(ctx context.Context, client *Client) error
+
+// CollectFromClientsFunc -> same as ForEachClientFunc, but it returns a value
+type CollectFromClientsFunc func(ctx context.Context, client *Client) (interface{}, error)
+
+// ForEachClient -> calls the function for the clients found by the filter, on at most concurrency workers
+// (DefaultForEachClientConcurrency if <= 0)
+// The clients are taken from a snapshot, the ones registered meanwhile are not processed and the ones which
+// have finished meanwhile are skipped
+// It returns the errors by connection ID, and the context error if it has been canceled before processing all
+// the clients
+func (s *Server) ForEachClient(
+	ctx context.Context,
+	filter FindClientsFilter,
+	concurrency int,
+	fn ForEachClientFunc,
+) (map[uint64]error, error) {
+	results, _err := s.CollectFromClients(ctx, filter, concurrency, func(ctx context.Context, client *Client) (interface{}, error) {
+		return nil, fn(ctx, client)
+	})
+	errs := make(map[uint64]error)
+	for connectionID, result := range results {
+		if result.Err != nil {
+			errs[connectionID] = result.Err
+		}
+	}
+	return errs, _err
+}
+
+// CollectFromClients -> same as ForEachClient, but the values returned by the function are collected
+// The results contain only the processed clients
+func (s *Server) CollectFromClients(
+	ctx context.Context,
+	filter FindClientsFilter,
+	concurrency int,
+	fn CollectFromClientsFunc,
+) (map[uint64]ClientResult, error) {
+	if fn == nil {
+		return nil, define.Err(0, "for each client function is nil")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if concurrency <= 0 {
+		concurrency = DefaultForEachClientConcurrency
+	}
+
+	// It's already a copy, the registry can change meanwhile
+	// Only the clients of this node, the remote ones can't be called
+	snapshot := s.c.getClientsByFilter(filter)
+	clients := make([]*Client, 0, len(snapshot))
+	for _, client := range snapshot {
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].connectionID < clients[j].connectionID
+	})
+	if concurrency > len(clients) {
+		concurrency = len(clients)
+	}
+
+	results := make(map[uint64]ClientResult, len(clients))
+	var resultsLock sync.Mutex
+	jobs := make(chan *Client)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for client := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				value, _err := callForClient(ctx, client, fn)
+				resultsLock.Lock()
+				results[client.connectionID] = ClientResult{Client: client, Value: value, Err: _err}
+				resultsLock.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, client := range clients {
+		if client.isClosed.Get() {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- client:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return results, ctx.Err()
+}
+
+// callForClient -> a panic of the function is returned as error
+func callForClient(ctx context.Context, client *Client, fn CollectFromClientsFunc) (value interface{}, _err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			_err = define.Err(0, "for each client function has panicked", client.connectionID, fmt.Sprint(r))
+		}
+	}()
+	return fn(ctx, client)
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kyaxcorp/go-http/config"
+)
+
+// DisconnectedClient -> the details of a client at the moment it has been unregistered
+type DisconnectedClient struct {
+	ClientDetails
+	Kind           ClientKind
+	DisconnectedAt time.Time
+	// DisconnectReason -> the reason given to Disconnect, or FinishedReason
+	DisconnectReason string
+	// CloseCode -> the code given to DisconnectGracefully
+	CloseCode       uint16
+	DurationSeconds int64
+}
+
+func (d DisconnectedClient) GetConnectionID() uint64 {
+	return uint64(d.ConnectionID)
+}
+
+func (d DisconnectedClient) GetUserID() string {
+	return d.UserID
+}
+
+func (d DisconnectedClient) GetDeviceID() string {
+	return d.DeviceID
+}
+
+// GetAuthToken -> the token is not kept in the history
+func (d DisconnectedClient) GetAuthToken() string {
+	return ""
+}
+
+func (d DisconnectedClient) GetIPAddress() string {
+	return d.ClientIP
+}
+
+func (d DisconnectedClient) GetRequestPath() string {
+	return d.RequestPath
+}
+
+func (d DisconnectedClient) Rooms() []string {
+	return d.ClientDetails.Rooms
+}
+
+func (d DisconnectedClient) hasIndexedKey(indexName string, key string) bool {
+	return false
+}
+
+// newDisconnectedClient -> it should be called before unregistering, the client still has its rooms
+func newDisconnectedClient(client *Client) DisconnectedClient {
+	now := time.Now()
+	reason := client.GetDisconnectReason()
+	if reason == "" {
+		reason = FinishedReason
+	}
+	return DisconnectedClient{
+		ClientDetails:    newClientDetails(client),
+		Kind:             client.GetKind(),
+		DisconnectedAt:   now,
+		DisconnectReason: reason,
+		CloseCode:        client.GetCloseCode(),
+		DurationSeconds:  int64(now.Sub(client.connectTime).Seconds()),
+	}
+}
+
+//-------------------------------------\\
+
+// disconnectHistory -> a ring buffer with the recently disconnected clients
+type disconnectHistory struct {
+	lock    sync.RWMutex
+	entries []DisconnectedClient
+	// next -> the position of the next entry, count -> the nr. of valid entries
+	next   int
+	count  int
+	maxAge time.Duration
+	// kinds -> the recorded kinds of clients, see config.DisconnectHistory.Kinds
+	kinds map[string]bool
+}
+
+func newDisconnectHistory(size int, maxAge time.Duration, kinds []string) *disconnectHistory {
+	h := &disconnectHistory{}
+	h.configure(size, maxAge)
+	h.setKinds(kinds)
+	return h
+}
+
+// setKinds -> if empty, config.DefaultDisconnectHistoryKinds are recorded
+func (h *disconnectHistory) setKinds(kinds []string) {
+	if len(kinds) == 0 {
+		kinds = config.DefaultDisconnectHistoryKinds
+	}
+	kindsMap := make(map[string]bool, len(kinds))
+	for _, kind := range kinds {
+		kindsMap[kind] = true
+	}
+	h.lock.Lock()
+	h.kinds = kindsMap
+	h.lock.Unlock()
+}
+
+// records -> checks if the client should be added to the history, it's checked before collecting its details
+func (h *disconnectHistory) records(client *Client) bool {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if len(h.entries) == 0 {
+		return false
+	}
+	if h.kinds[config.DisconnectHistoryKindDisconnected] && client.IsDisconnecting() {
+		return true
+	}
+	return h.kinds[string(client.GetKind())]
+}
+
+// configure -> the newest entries are kept when the size is reduced
+func (h *disconnectHistory) configure(size int, maxAge time.Duration) {
+	if size < 0 {
+		size = 0
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	kept := h.newest(size)
+	h.entries = make([]DisconnectedClient, size)
+	h.count = 0
+	h.next = 0
+	h.maxAge = maxAge
+	for i := len(kept) - 1; i >= 0; i-- {
+		h.push(kept[i])
+	}
+}
+
+func (h *disconnectHistory) add(entry DisconnectedClient) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.push(entry)
+}
+
+// push -> the programmer should handle locks before!
+func (h *disconnectHistory) push(entry DisconnectedClient) {
+	if len(h.entries) == 0 {
+		return
+	}
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % len(h.entries)
+	if h.count < len(h.entries) {
+		h.count++
+	}
+}
+
+// newest -> at most limit entries, the newest first, the programmer should handle locks before!
+func (h *disconnectHistory) newest(limit int) []DisconnectedClient {
+	if limit > h.count {
+		limit = h.count
+	}
+	entries := make([]DisconnectedClient, 0, limit)
+	for i := 1; i <= limit; i++ {
+		entries = append(entries, h.entries[(h.next-i+len(h.entries))%len(h.entries)])
+	}
+	return entries
+}
+
+// find -> the entries matching the filter and not older than maxAge, the newest first
+func (h *disconnectHistory) find(filter FindClientsFilter) []DisconnectedClient {
+	prepareFilter(&filter)
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	var oldest time.Time
+	if h.maxAge > 0 {
+		oldest = time.Now().Add(-h.maxAge)
+	}
+	entries := make([]DisconnectedClient, 0)
+	for _, entry := range h.newest(h.count) {
+		if !oldest.IsZero() && entry.DisconnectedAt.Before(oldest) {
+			// The next ones are older
+			break
+		}
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// RecentDisconnects -> the recently disconnected clients matching the filter, the newest first
+// Use FindClientsFilter.All for all of them (the auth tokens and the custom indexes are not kept)
+func (s *Server) RecentDisconnects(filter FindClientsFilter) []DisconnectedClient {
+	return s.disconnectHistory.find(filter)
+}
+
+// SetDisconnectHistory -> changes the size and the max age of the history, set size 0 for disabling it
+func (s *Server) SetDisconnectHistory(size int, maxAge time.Duration) *Server {
+	s.disconnectHistory.configure(size, maxAge)
+	return s
+}
+
+// SetDisconnectHistoryKinds -> which clients are recorded (see config.DisconnectHistory.Kinds), if empty
+// config.DefaultDisconnectHistoryKinds are recorded
+func (s *Server) SetDisconnectHistoryKinds(kinds []string) *Server {
+	s.disconnectHistory.setKinds(kinds)
+	return s
+}
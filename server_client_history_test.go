@@ -0,0 +1,74 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kyaxcorp/go-http/config"
+)
+
+func TestClientKindsMatchTheConfig(t *testing.T) {
+	for kind, configKind := range map[ClientKind]string{
+		ClientKindRequest:   config.DisconnectHistoryKindRequest,
+		ClientKindSSE:       config.DisconnectHistoryKindSSE,
+		ClientKindWebSocket: config.DisconnectHistoryKindWebSocket,
+		ClientKindHijacked:  config.DisconnectHistoryKindHijacked,
+	} {
+		if string(kind) != configKind || !config.IsValidDisconnectHistoryKind(string(kind)) {
+			t.Errorf("the client kind %q doesn't match the config kind %q", kind, configKind)
+		}
+	}
+}
+
+// TestDisconnectHistoryKinds -> by default only the long-lived clients and the disconnected ones are recorded
+func TestDisconnectHistoryKinds(t *testing.T) {
+	s := newTestServer(t)
+	s.HttpServer.GET("/plain", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	s.HttpServer.GET("/stream", func(c *gin.Context) {
+		client := GetClientFromCtx(c)
+		client.startSending(sendKindSSE, 1)
+		client.stopSending()
+	})
+	s.HttpServer.GET("/kicked", func(c *gin.Context) {
+		_ = GetClientFromCtx(c).Disconnect("kicked")
+	})
+	serve := func(path string) {
+		s.HttpServer.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	recordedPaths := func() map[string]DisconnectedClient {
+		paths := make(map[string]DisconnectedClient)
+		for _, entry := range s.RecentDisconnects(FindClientsFilter{All: true}) {
+			paths[entry.RequestPath] = entry
+		}
+		return paths
+	}
+
+	for _, path := range []string{"/plain", "/stream", "/kicked"} {
+		serve(path)
+	}
+	recorded := recordedPaths()
+	if _, ok := recorded["/plain"]; ok || len(recorded) != 2 {
+		t.Errorf("expected only /stream and /kicked to be recorded, got %v", recorded)
+	}
+	if recorded["/stream"].Kind != ClientKindSSE || recorded["/stream"].DisconnectReason != FinishedReason {
+		t.Errorf("unexpected /stream entry: %+v", recorded["/stream"])
+	}
+	if recorded["/kicked"].Kind != ClientKindRequest || recorded["/kicked"].DisconnectReason != "kicked" {
+		t.Errorf("unexpected /kicked entry: %+v", recorded["/kicked"])
+	}
+
+	// Only the plain requests, the history is emptied before
+	s.SetDisconnectHistory(0, 0).SetDisconnectHistory(10, 0)
+	s.SetDisconnectHistoryKinds([]string{config.DisconnectHistoryKindRequest})
+	for _, path := range []string{"/plain", "/stream"} {
+		serve(path)
+	}
+	recorded = recordedPaths()
+	if _, ok := recorded["/plain"]; !ok || len(recorded) != 1 {
+		t.Errorf("expected only /plain to be recorded, got %v", recorded)
+	}
+}
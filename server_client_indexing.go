@@ -3,8 +3,10 @@ package server
 import (
 	"math"
 	"sync"
+	"sync/atomic"
 
 	"github.com/kyaxcorp/go-helper/array"
+	"github.com/kyaxcorp/go-http/middlewares/authentication"
 )
 
 type FindClientsFilter struct {
@@ -21,6 +23,10 @@ type FindClientsFilter struct {
 	IPAddresses []string
 	// Route Paths
 	RequestPaths []string
+	// Rooms (Names), see Client.Join
+	Rooms []string
+	// Indexes -> the keys searched in the user-defined indexes, by index name (see RegisterClientIndex)
+	Indexes map[string][]string
 	// Exception List (usually used in tandem with All param) if sending to everyone
 	ExceptConnections  []uint64
 	ExceptUsers        []string
@@ -28,6 +34,7 @@ type FindClientsFilter struct {
 	ExceptAuthTokens   []string
 	ExceptIPAddresses  []string
 	ExceptRequestPaths []string
+	ExceptRooms        []string
 
 	// Exception List Maps (converted automatically when the struct it's being created)
 	exceptConnectionsMap  map[uint64]int
@@ -36,6 +43,7 @@ type FindClientsFilter struct {
 	exceptAuthTokensMap   map[string]int
 	exceptIPAddressesMap  map[string]int
 	exceptRequestPathsMap map[string]int
+	exceptRoomsMap        map[string]int
 
 	// Exception List Checks if are enabled
 	isExceptConnections  bool
@@ -44,258 +52,303 @@ type FindClientsFilter struct {
 	isExceptAuthTokens   bool
 	isExceptIPAddresses  bool
 	isExceptRequestPaths bool
+	isExceptRooms        bool
 }
 
+// prepareFilter -> creates the exceptions filters map for better indexing and performance
+// The maps are created only for the defined exception lists
 func prepareFilter(filter *FindClientsFilter) *FindClientsFilter {
-	// TODO: use Goroutines here
-
-	var awaitGroup sync.WaitGroup
-	awaitGroup.Add(6)
-
-	// Create the exceptions filters map for better indexing and performance
-	go func() {
-		defer func() {
-			awaitGroup.Done()
-		}()
-		if len(filter.ExceptConnections) > 0 {
-			filter.isExceptConnections = true
-			filter.exceptConnectionsMap = array.ConvUint64ValuesToMapKey(filter.ExceptConnections)
+	if len(filter.ExceptConnections) > 0 {
+		filter.isExceptConnections = true
+		filter.exceptConnectionsMap = array.ConvUint64ValuesToMapKey(filter.ExceptConnections)
+	}
+	if len(filter.ExceptUsers) > 0 {
+		filter.isExceptUsers = true
+		filter.exceptUsersMap = array.ConvStringValuesToMapKey(filter.ExceptUsers)
+	}
+	if len(filter.ExceptDevices) > 0 {
+		filter.isExceptDevices = true
+		filter.exceptDevicesMap = array.ConvStringValuesToMapKey(filter.ExceptDevices)
+	}
+	if len(filter.ExceptAuthTokens) > 0 {
+		filter.isExceptAuthTokens = true
+		filter.exceptAuthTokensMap = array.ConvStringValuesToMapKey(filter.ExceptAuthTokens)
+	}
+	if len(filter.ExceptIPAddresses) > 0 {
+		filter.isExceptIPAddresses = true
+		filter.exceptIPAddressesMap = array.ConvStringValuesToMapKey(filter.ExceptIPAddresses)
+	}
+	if len(filter.ExceptRequestPaths) > 0 {
+		filter.isExceptRequestPaths = true
+		filter.exceptRequestPathsMap = array.ConvStringValuesToMapKey(filter.ExceptRequestPaths)
+	}
+	if len(filter.ExceptRooms) > 0 {
+		filter.isExceptRooms = true
+		filter.exceptRoomsMap = array.ConvStringValuesToMapKey(filter.ExceptRooms)
+	}
+	return filter
+}
+
+// filterSubject -> what the filter checks, it's implemented by Client and ClusterClient
+type filterSubject interface {
+	GetConnectionID() uint64
+	GetUserID() string
+	GetDeviceID() string
+	GetAuthToken() string
+	GetIPAddress() string
+	GetRequestPath() string
+	Rooms() []string
+	hasIndexedKey(indexName string, key string) bool
+}
+
+// isExcepted -> checks the client against all the exception lists
+func (filter *FindClientsFilter) isExcepted(client filterSubject) bool {
+	if filter.isExceptDevices {
+		if _, ok := filter.exceptDevicesMap[client.GetDeviceID()]; ok {
+			return true
 		}
-	}()
-	go func() {
-		defer func() {
-			awaitGroup.Done()
-		}()
-		if len(filter.ExceptUsers) > 0 {
-			filter.isExceptUsers = true
-			filter.exceptUsersMap = array.ConvStringValuesToMapKey(filter.ExceptUsers)
+	}
+	if filter.isExceptUsers {
+		if _, ok := filter.exceptUsersMap[client.GetUserID()]; ok {
+			return true
 		}
-	}()
-	go func() {
-		defer func() {
-			awaitGroup.Done()
-		}()
-		if len(filter.ExceptDevices) > 0 {
-			filter.isExceptDevices = true
-			filter.exceptDevicesMap = array.ConvStringValuesToMapKey(filter.ExceptDevices)
+	}
+	if filter.isExceptConnections {
+		if _, ok := filter.exceptConnectionsMap[client.GetConnectionID()]; ok {
+			return true
 		}
-	}()
-	go func() {
-		defer func() {
-			awaitGroup.Done()
-		}()
-		if len(filter.ExceptAuthTokens) > 0 {
-			filter.isExceptAuthTokens = true
-			filter.exceptAuthTokensMap = array.ConvStringValuesToMapKey(filter.ExceptAuthTokens)
+	}
+	if filter.isExceptIPAddresses {
+		if _, ok := filter.exceptIPAddressesMap[client.GetIPAddress()]; ok {
+			return true
 		}
-	}()
-	go func() {
-		defer func() {
-			awaitGroup.Done()
-		}()
-		if len(filter.ExceptIPAddresses) > 0 {
-			filter.isExceptIPAddresses = true
-			filter.exceptIPAddressesMap = array.ConvStringValuesToMapKey(filter.ExceptIPAddresses)
+	}
+	if filter.isExceptAuthTokens {
+		if _, ok := filter.exceptAuthTokensMap[client.GetAuthToken()]; ok {
+			return true
 		}
-	}()
-	go func() {
-		defer func() {
-			awaitGroup.Done()
-		}()
-		if len(filter.ExceptRequestPaths) > 0 {
-			filter.isExceptRequestPaths = true
-			filter.exceptRequestPathsMap = array.ConvStringValuesToMapKey(filter.ExceptRequestPaths)
+	}
+	if filter.isExceptRequestPaths {
+		if _, ok := filter.exceptRequestPathsMap[client.GetRequestPath()]; ok {
+			return true
 		}
-	}()
-	awaitGroup.Wait()
-	return filter
+	}
+	if filter.isExceptRooms {
+		for _, room := range client.Rooms() {
+			if _, ok := filter.exceptRoomsMap[room]; ok {
+				return true
+			}
+		}
+	}
+	return false
 }
 
-type clientsData struct {
-	// Locks
-	clientsLock sync.RWMutex
+// matches -> checks a single client (local or from the cluster), with the same rules as getClientsByFilter
+// The filter should be prepared before!
+func (filter *FindClientsFilter) matches(client filterSubject) bool {
+	if filter.All {
+		return !filter.isExcepted(client)
+	}
+	inList := func(list []string, value string, exceptMap map[string]int) bool {
+		if value == "" {
+			return false
+		}
+		if _, ok := exceptMap[value]; ok {
+			return false
+		}
+		for _, v := range list {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+	if inList(filter.Users, client.GetUserID(), filter.exceptUsersMap) ||
+		inList(filter.Devices, client.GetDeviceID(), filter.exceptDevicesMap) ||
+		inList(filter.AuthTokens, client.GetAuthToken(), filter.exceptAuthTokensMap) ||
+		inList(filter.IPAddresses, client.GetIPAddress(), filter.exceptIPAddressesMap) ||
+		inList(filter.RequestPaths, client.GetRequestPath(), filter.exceptRequestPathsMap) {
+		return true
+	}
+	for _, room := range client.Rooms() {
+		if inList(filter.Rooms, room, filter.exceptRoomsMap) {
+			return true
+		}
+	}
+	for indexName, keys := range filter.Indexes {
+		for _, key := range keys {
+			if client.hasIndexedKey(indexName, key) {
+				return true
+			}
+		}
+	}
+	if _, ok := filter.exceptConnectionsMap[client.GetConnectionID()]; ok {
+		return false
+	}
+	for _, connectionID := range filter.Connections {
+		if connectionID == client.GetConnectionID() {
+			return true
+		}
+	}
+	return false
+}
+
+// clientsShards -> the nr. of shards in which the clients are split (by connection ID)
+// Connects/disconnects of different clients lock different shards, in this way they don't serialize on one lock
+// The other indexes (users, devices, rooms...) are split by hash of the key, see keyIndexes
+const clientsShards = 64
+
+// clientsShard -> contains a part of the clients together with their connection IDs
+// The shard stays locked while the keys of the client are updated, so a client is always present (or missing)
+// in the main map and in all the indexes at once
+type clientsShard struct {
+	lock sync.RWMutex
 
 	// Data
 	clients map[*Client]bool
-	// Indexes
-	clientsIndex   ClientsIndex
+	// connections -> the Connections index
+	connections map[uint64]*Client
+}
+
+func newClientsShard() *clientsShard {
+	return &clientsShard{
+		clients:     make(map[*Client]bool),
+		connections: make(map[uint64]*Client),
+	}
+}
+
+type clientsData struct {
+	// shards -> the clients are split by connection ID, each shard has its own lock
+	shards [clientsShards]*clientsShard
+	// keys -> the indexes by key, they are split by hash of the key
+	keys *keyIndexes
+	// nrOfClients -> it's counted separately, so it can be read without locking the shards
+	nrOfClients atomic.Int64
+
+	// customIndexes -> the user-defined indexes, by name
+	customIndexes     map[string]*customClientIndex
+	customIndexesLock sync.RWMutex
+
+	// presence -> the nr. of connections by user and device, it doesn't depend on enableIndexing
+	presence *presenceTracker
+
 	enableIndexing bool
 }
 
-func (c *clientsData) GetNrOfClients() uint {
-	defer func() {
-		c.clientsLock.RUnlock()
-	}()
-	c.clientsLock.RLock()
-	return uint(len(c.clients))
+// getShard -> returns the shard in which the connection is stored
+func (c *clientsData) getShard(connectionID uint64) *clientsShard {
+	return c.shards[connectionID%clientsShards]
 }
 
-func (c *clientsData) createUsersIndexMap(client *Client) {
-	if _, ok := c.clientsIndex.Users[client.authDetails.UserDetails.UserID]; !ok {
-		// Create the map!
-		c.clientsIndex.Users[client.authDetails.UserDetails.UserID] = make(map[uint64]*Client)
+// forEachShard -> calls the function for each shard while holding its read lock
+func (c *clientsData) forEachShard(f func(shard *clientsShard)) {
+	for _, shard := range c.shards {
+		shard.lock.RLock()
+		f(shard)
+		shard.lock.RUnlock()
 	}
 }
 
-func (c *clientsData) createDevicesIndexMap(client *Client) {
-	if _, ok := c.clientsIndex.Devices[client.authDetails.DeviceDetails.DeviceID]; !ok {
-		// Create the map!
-		c.clientsIndex.Devices[client.authDetails.DeviceDetails.DeviceID] = make(map[uint64]*Client)
-	}
+func (c *clientsData) GetNrOfClients() uint {
+	return uint(c.nrOfClients.Load())
 }
 
-func (c *clientsData) createAuthTokensIndexMap(client *Client) {
-	if _, ok := c.clientsIndex.AuthTokens[client.authDetails.AuthTokenDetails.Token]; !ok {
+// addToIndex -> the programmer should handle locks before!
+func addToIndex(index map[string]map[uint64]*Client, key string, client *Client) {
+	if key == "" {
+		return
+	}
+	if _, ok := index[key]; !ok {
 		// Create the map!
-		c.clientsIndex.AuthTokens[client.authDetails.AuthTokenDetails.Token] = make(map[uint64]*Client)
+		index[key] = make(map[uint64]*Client)
 	}
+	index[key][client.connectionID] = client
 }
 
-func (c *clientsData) createIPAddressesIndexMap(client *Client) {
-	if _, ok := c.clientsIndex.IPAddresses[client.connDetails.ClientIPAddress]; !ok {
-		// Create the map!
-		c.clientsIndex.IPAddresses[client.connDetails.ClientIPAddress] = make(map[uint64]*Client)
+// removeFromIndex -> the programmer should handle locks before!
+// The empty maps are removed, otherwise the index grows with each user/device/token ever connected
+func removeFromIndex(index map[string]map[uint64]*Client, key string, client *Client) {
+	if key == "" {
+		return
+	}
+	clients, ok := index[key]
+	if !ok {
+		return
+	}
+	delete(clients, client.connectionID)
+	if len(clients) == 0 {
+		delete(index, key)
 	}
 }
 
-func (c *clientsData) createRequestPathIndexMap(client *Client) {
-	if _, ok := c.clientsIndex.RequestPath[client.connDetails.RequestPath]; !ok {
-		// Create the map!
-		c.clientsIndex.RequestPath[client.connDetails.RequestPath] = make(map[uint64]*Client)
+// authIndexChanges -> the keys of the auth details in the users, devices and auth tokens indexes
+func authIndexChanges(changes []indexChange, authDetails *authentication.AuthDetails, add bool) []indexChange {
+	if authDetails == nil {
+		return changes
 	}
+	return append(changes,
+		indexChange{getIndex: indexUsers, key: authDetails.UserDetails.UserID, add: add},
+		indexChange{getIndex: indexDevices, key: authDetails.DeviceDetails.DeviceID, add: add},
+		indexChange{getIndex: indexAuthTokens, key: authDetails.AuthTokenDetails.Token, add: add},
+	)
 }
 
-func (c *clientsData) createIndexes(client *Client) {
-	connectionID := client.connectionID
-
+// createIndexes -> the programmer should handle the lock of the client's shard before!
+func (c *clientsData) createIndexes(shard *clientsShard, client *Client, customIndexes []*customClientIndex) {
 	// ------------------Add to indexes for faster finding!-------------------\\
 	// By Connection ID
-	c.clientsIndex.connectionsLock.Lock()
-	c.clientsIndex.Connections[connectionID] = client
-	c.clientsIndex.connectionsLock.Unlock()
-
-	// Check if authDetails exists!
-	if client.authDetails != nil {
-		// Users
-		if client.authDetails.UserDetails.UserID != "" {
-			c.clientsIndex.usersLock.Lock()
-			c.createUsersIndexMap(client)
-			// Add the reference to index
-			c.clientsIndex.Users[client.authDetails.UserDetails.UserID][connectionID] = client
-			c.clientsIndex.usersLock.Unlock()
-		}
-
-		// Devices
-		if client.authDetails.DeviceDetails.DeviceID != "" {
-			c.clientsIndex.devicesLock.Lock()
-			c.createDevicesIndexMap(client)
-			// Add the reference to index
-			c.clientsIndex.Devices[client.authDetails.DeviceDetails.DeviceID][connectionID] = client
-			c.clientsIndex.devicesLock.Unlock()
-		}
-
-		// Auth Tokens
-		if client.authDetails.AuthTokenDetails.Token != "" {
-			c.clientsIndex.authTokensLock.Lock()
-			c.createAuthTokensIndexMap(client)
-			// Add the reference to index
-			c.clientsIndex.AuthTokens[client.authDetails.AuthTokenDetails.Token][connectionID] = client
-			c.clientsIndex.authTokensLock.Unlock()
-		}
-	}
+	shard.connections[client.connectionID] = client
 
+	changes := authIndexChanges(make([]indexChange, 0, 8), client.GetAuthDetails(), true)
 	if client.connDetails != nil {
-		// IP Addresses
-		if client.connDetails.ClientIPAddress != "" {
-			c.clientsIndex.ipAddressesLock.Lock()
-			c.createIPAddressesIndexMap(client)
-			// Add the reference to index
-			c.clientsIndex.IPAddresses[client.connDetails.ClientIPAddress][connectionID] = client
-			c.clientsIndex.ipAddressesLock.Unlock()
-		}
-
-		// Request Path / Request URI / ROUTE PATH
-		if client.connDetails.RequestPath != "" {
-			c.clientsIndex.requestPathLock.Lock()
-			c.createRequestPathIndexMap(client)
-			// Add the reference to index
-			c.clientsIndex.RequestPath[client.connDetails.RequestPath][connectionID] = client
-			c.clientsIndex.requestPathLock.Unlock()
-		}
-	}
+		changes = append(changes,
+			// IP Addresses
+			indexChange{getIndex: indexIPAddresses, key: client.connDetails.ClientIPAddress, add: true},
+			// Request Path / Request URI / ROUTE PATH
+			indexChange{getIndex: indexRequestPath, key: client.connDetails.RequestPath, add: true},
+		)
+	}
+	// Rooms
+	for _, room := range client.Rooms() {
+		changes = append(changes, indexChange{getIndex: indexRooms, key: room, add: true})
+	}
+	changes = customIndexChanges(changes, client, customIndexes)
+	c.keys.update(client, changes)
 	// ------------------Add to indexes for faster finding!-------------------\\
 }
 
-func (c *clientsData) unsetIndexes(client *Client) {
-	connectionID := client.connectionID
-
+// unsetIndexes -> the programmer should handle the lock of the client's shard before!
+func (c *clientsData) unsetIndexes(shard *clientsShard, client *Client) {
 	// Delete from connections
-	c.clientsIndex.connectionsLock.Lock()
-	if _, ok := c.clientsIndex.Connections[connectionID]; ok {
-		delete(c.clientsIndex.Connections, connectionID)
-	}
-	c.clientsIndex.connectionsLock.Unlock()
-
-	// Delete from users
-	if client.authDetails != nil {
-
-		if client.authDetails.UserDetails.UserID != "" {
-			c.clientsIndex.usersLock.Lock()
-			c.createUsersIndexMap(client)
-			if _, ok := c.clientsIndex.Users[client.authDetails.UserDetails.UserID][connectionID]; ok {
-				delete(c.clientsIndex.Users[client.authDetails.UserDetails.UserID], connectionID)
-			}
-			c.clientsIndex.usersLock.Unlock()
-		}
-
-		// Devices
-		if client.authDetails.DeviceDetails.DeviceID != "" {
-			c.clientsIndex.devicesLock.Lock()
-			c.createDevicesIndexMap(client)
-			if _, ok := c.clientsIndex.Devices[client.authDetails.DeviceDetails.DeviceID][connectionID]; ok {
-				delete(c.clientsIndex.Devices[client.authDetails.DeviceDetails.DeviceID], connectionID)
-			}
-			c.clientsIndex.devicesLock.Unlock()
-		}
-
-		// Auth Tokens
-		if client.authDetails.AuthTokenDetails.Token != "" {
-			c.clientsIndex.authTokensLock.Lock()
-			c.createAuthTokensIndexMap(client)
-			if _, ok := c.clientsIndex.AuthTokens[client.authDetails.AuthTokenDetails.Token][connectionID]; ok {
-				delete(c.clientsIndex.AuthTokens[client.authDetails.AuthTokenDetails.Token], connectionID)
-			}
-			c.clientsIndex.authTokensLock.Unlock()
-		}
-	}
+	delete(shard.connections, client.connectionID)
 
+	changes := authIndexChanges(make([]indexChange, 0, 8), client.GetAuthDetails(), false)
 	if client.connDetails != nil {
-		// IP Addresses
-		if client.connDetails.ClientIPAddress != "" {
-			c.clientsIndex.ipAddressesLock.Lock()
-			c.createIPAddressesIndexMap(client)
-			if _, ok := c.clientsIndex.IPAddresses[client.connDetails.ClientIPAddress][connectionID]; ok {
-				delete(c.clientsIndex.IPAddresses[client.connDetails.ClientIPAddress], connectionID)
-			}
-			c.clientsIndex.ipAddressesLock.Unlock()
-		}
+		changes = append(changes,
+			indexChange{getIndex: indexIPAddresses, key: client.connDetails.ClientIPAddress},
+			indexChange{getIndex: indexRequestPath, key: client.connDetails.RequestPath},
+		)
+	}
+	// Rooms - the client leaves all of them
+	for _, room := range client.leaveAllRooms() {
+		changes = append(changes, indexChange{getIndex: indexRooms, key: room})
+	}
+	changes = unsetCustomIndexChanges(changes, client)
+	c.keys.update(client, changes)
+}
 
-		// Request Paths
-		if client.connDetails.RequestPath != "" {
-			c.clientsIndex.requestPathLock.Lock()
-			c.createRequestPathIndexMap(client)
-			if _, ok := c.clientsIndex.RequestPath[client.connDetails.RequestPath][connectionID]; ok {
-				delete(c.clientsIndex.RequestPath[client.connDetails.RequestPath], connectionID)
-			}
-			c.clientsIndex.requestPathLock.Unlock()
-		}
+// copyClientsInto -> the programmer should handle locks before!
+func copyClientsInto(dst map[uint64]*Client, clients map[uint64]*Client) {
+	for connectionID, client := range clients {
+		dst[connectionID] = client
 	}
 }
 
 func (c *clientsData) GetClientByID(connectionID uint64) *Client {
-	c.clientsIndex.connectionsLock.RLock()
-	client, ok := c.clientsIndex.Connections[connectionID]
-	c.clientsIndex.connectionsLock.RUnlock()
+	shard := c.getShard(connectionID)
+	shard.lock.RLock()
+	defer shard.lock.RUnlock()
+	client, ok := shard.connections[connectionID]
 	if !ok {
 		return nil
 	}
@@ -303,25 +356,21 @@ func (c *clientsData) GetClientByID(connectionID uint64) *Client {
 }
 
 func (c *clientsData) GetClients() map[*Client]bool {
-	defer func() {
-		c.clientsLock.RUnlock()
-	}()
 	// We are copying the clients into a new map because
 	// if returning directly the map, the programmer should handle the locks
 	// But if you don't handle locks, then we should copy the map to be store in a diff address space
 	// Returning Maps is like returning pointers
 	nmap := make(map[*Client]bool)
-	c.clientsLock.RLock()
-	for k, v := range c.clients {
-		nmap[k] = v
-	}
+	c.forEachShard(func(shard *clientsShard) {
+		for k, v := range shard.clients {
+			nmap[k] = v
+		}
+	})
 	return nmap
 }
 
 func (c *clientsData) GetClientsInChunks(nrOfChunks uint16) []map[*Client]bool {
-	defer c.clientsLock.RUnlock()
-	c.clientsLock.RLock()
-	return GetClientsInChunks(c.clients, nrOfChunks)
+	return GetClientsInChunks(c.GetClients(), nrOfChunks)
 }
 
 // the programmer should handle locks before!!
@@ -384,398 +433,221 @@ func GetClientsInChunksWithConn(clients map[uint64]*Client, nrOfChunks uint16) [
 }
 
 func (c *clientsData) GetClientsList() map[uint64]*Client {
-
-	c.clientsIndex.connectionsLock.RLock()
 	nmap := make(map[uint64]*Client)
-	for k, v := range c.clientsIndex.Connections {
-		nmap[k] = v
-	}
-	c.clientsIndex.connectionsLock.RUnlock()
+	c.forEachShard(func(shard *clientsShard) {
+		copyClientsInto(nmap, shard.connections)
+	})
 	return nmap
 }
 
-func (c *clientsData) GetClientsByUserID(userID string) map[uint64]*Client {
-	c.clientsIndex.usersLock.RLock()
-	clients, ok := c.clientsIndex.Users[userID]
-	c.clientsIndex.usersLock.RUnlock()
-	if !ok || len(clients) == 0 {
-		return nil
+// Snapshot -> a copy of the main map and all the indexes
+// All the shards are locked while copying, so a client is always present (or missing) in all the indexes
+// It blocks the writers meanwhile, use the lookups (GetClientsByUserID...) which lock only the shard of the key
+func (c *clientsData) Snapshot() ClientsIndex {
+	snapshot := ClientsIndex{
+		Users:       make(map[string]map[uint64]*Client),
+		Devices:     make(map[string]map[uint64]*Client),
+		Connections: make(map[uint64]*Client),
+		AuthTokens:  make(map[string]map[uint64]*Client),
+		IPAddresses: make(map[string]map[uint64]*Client),
+		RequestPath: make(map[string]map[uint64]*Client),
+		Rooms:       make(map[string]map[uint64]*Client),
+		Custom:      make(map[string]map[string]map[uint64]*Client),
+	}
+	copyIndex := func(dst, index map[string]map[uint64]*Client) {
+		for key, clients := range index {
+			if _, ok := dst[key]; !ok {
+				dst[key] = make(map[uint64]*Client, len(clients))
+			}
+			copyClientsInto(dst[key], clients)
+		}
 	}
-	return clients
+
+	// Same order as the writers: the clients shards first, then the keys shards (ascending)
+	for _, shard := range c.shards {
+		shard.lock.RLock()
+		defer shard.lock.RUnlock()
+		copyClientsInto(snapshot.Connections, shard.connections)
+	}
+	for _, shard := range c.keys.shards {
+		shard.lock.RLock()
+		defer shard.lock.RUnlock()
+		copyIndex(snapshot.Users, shard.index.Users)
+		copyIndex(snapshot.Devices, shard.index.Devices)
+		copyIndex(snapshot.AuthTokens, shard.index.AuthTokens)
+		copyIndex(snapshot.IPAddresses, shard.index.IPAddresses)
+		copyIndex(snapshot.RequestPath, shard.index.RequestPath)
+		copyIndex(snapshot.Rooms, shard.index.Rooms)
+		for indexName, index := range shard.index.Custom {
+			if _, ok := snapshot.Custom[indexName]; !ok {
+				snapshot.Custom[indexName] = make(map[string]map[uint64]*Client)
+			}
+			copyIndex(snapshot.Custom[indexName], index)
+		}
+	}
+	return snapshot
+}
+
+// getClientsByIndex -> only the shard of the key is locked
+// It returns nil if there are no clients
+func (c *clientsData) getClientsByIndex(getIndex indexGetter, key string) map[uint64]*Client {
+	return c.keys.get(getIndex, key)
+}
+
+func (c *clientsData) GetClientsByUserID(userID string) map[uint64]*Client {
+	return c.getClientsByIndex(indexUsers, userID)
 }
 
 func (c *clientsData) GetClientsByDeviceID(deviceID string) map[uint64]*Client {
-	c.clientsIndex.devicesLock.RLock()
-	clients, ok := c.clientsIndex.Devices[deviceID]
-	c.clientsIndex.devicesLock.RUnlock()
-	if !ok || len(clients) == 0 {
-		return nil
-	}
-	return clients
+	return c.getClientsByIndex(indexDevices, deviceID)
 }
 
 func (c *clientsData) GetClientsByAuthToken(authToken string) map[uint64]*Client {
-	c.clientsIndex.authTokensLock.RLock()
-	clients, ok := c.clientsIndex.AuthTokens[authToken]
-	c.clientsIndex.authTokensLock.RUnlock()
-	if !ok || len(clients) == 0 {
-		return nil
-	}
-	return clients
+	return c.getClientsByIndex(indexAuthTokens, authToken)
 }
 
 func (c *clientsData) GetClientsByIPAddress(ipAddress string) map[uint64]*Client {
-	c.clientsIndex.ipAddressesLock.RLock()
-	clients, ok := c.clientsIndex.IPAddresses[ipAddress]
-	c.clientsIndex.ipAddressesLock.RUnlock()
-	if !ok || len(clients) == 0 {
-		return nil
-	}
-	return clients
+	return c.getClientsByIndex(indexIPAddresses, ipAddress)
 }
 
 func (c *clientsData) GetClientsByRequestPath(requestPath string) map[uint64]*Client {
-	c.clientsIndex.requestPathLock.RLock()
-	clients, ok := c.clientsIndex.RequestPath[requestPath]
-	c.clientsIndex.requestPathLock.RUnlock()
-	if !ok || len(clients) == 0 {
-		return nil
-	}
-	return clients
+	return c.getClientsByIndex(indexRequestPath, requestPath)
 }
 
+// registerClient -> it's synchronous, when it returns the client can be found in the main map and in all indexes
 func (c *clientsData) registerClient(client *Client) *clientsData {
-	go func() {
-		c.clientsLock.Lock()
-		c.clients[client] = true
-		c.clientsLock.Unlock()
-
-		if c.enableIndexing {
-			go c.createIndexes(client)
-		}
-	}()
+	customIndexes := c.getCustomIndexes("")
+	shard := c.getShard(client.connectionID)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	if shard.clients[client] {
+		// Already registered
+		return c
+	}
+	shard.clients[client] = true
+	c.nrOfClients.Add(1)
+	authDetails := client.GetAuthDetails()
+	c.presence.connected(authDetails.GetUserID(), authDetails.GetDeviceID())
+	if c.enableIndexing {
+		c.createIndexes(shard, client, customIndexes)
+	}
 	return c
 }
 
+// unregisterClient -> it's synchronous, when it returns the client is missing from the main map and from all indexes
 func (c *clientsData) unregisterClient(client *Client) *clientsData {
-	go func() {
-		if c.enableIndexing {
-			go c.unsetIndexes(client)
-		}
+	shard := c.getShard(client.connectionID)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	if !shard.clients[client] {
+		// Not registered (or already unregistered)
+		return c
+	}
+	// Remove the element from map
+	delete(shard.clients, client)
+	c.nrOfClients.Add(-1)
+	authDetails := client.GetAuthDetails()
+	c.presence.disconnected(authDetails.GetUserID(), authDetails.GetDeviceID())
+	if c.enableIndexing {
+		c.unsetIndexes(shard, client)
+	}
+	return c
+}
 
-		c.clientsLock.Lock()
-		if _, ok := c.clients[client]; ok {
-			// Remove the element from map
-			delete(c.clients, client)
+// updateClientAuthDetails -> replaces the auth details of the client and re-indexes it
+// It's called when the authentication middleware sets the details after the client has been registered
+func (c *clientsData) updateClientAuthDetails(client *Client, details *authentication.AuthDetails) {
+	if details == nil {
+		details = &authentication.AuthDetails{}
+	}
+	shard := c.getShard(client.connectionID)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	registered := shard.clients[client]
+	previous := client.GetAuthDetails()
+	client.setAuthDetails(details)
+	if registered && c.enableIndexing {
+		// The previous keys are removed first, the new ones can be the same
+		changes := authIndexChanges(make([]indexChange, 0, 6), previous, false)
+		c.keys.update(client, authIndexChanges(changes, details, true))
+	}
+	if registered {
+		// Connecting before disconnecting, so the same user doesn't go offline
+		c.presence.connected(details.GetUserID(), details.GetDeviceID())
+		c.presence.disconnected(previous.GetUserID(), previous.GetDeviceID())
+	}
+}
+
+// addClientsByIndex -> adds the clients of the keys into the clients map
+// It doesn't allocate intermediary maps
+func (c *clientsData) addClientsByIndex(
+	clients map[uint64]*Client,
+	getIndex indexGetter,
+	keys []string,
+	exceptMap map[string]int,
+) {
+	for _, key := range keys {
+		if key == "" {
+			continue
 		}
-		c.clientsLock.Unlock()
-	}()
-	return c
+		// Check if it's not excluded
+		if _, ok := exceptMap[key]; ok {
+			continue
+		}
+		c.keys.copyInto(clients, getIndex, key)
+	}
 }
 
+// getClientsByFilter -> it's running in the current goroutine, the indexes are searched one by one
 func (c *clientsData) getClientsByFilter(filter FindClientsFilter) map[uint64]*Client {
-	var nrOfLaunchedSearches = 0
-	var awaitGroup sync.WaitGroup
-
 	// Prepare the filter..
 	prepareFilter(&filter)
 
-	// TODO: we can also save where we have found the ClientsStatus
-	// We are searching through 6 indexes!
-
-	// There are no overheads on local slices when using len function!
-	foundClientsChan := make(chan map[uint64]*Client)
+	clients := make(map[uint64]*Client)
 
 	if filter.All {
 		// Send to all, but there are also exceptions!
-		// Get all available connections
-		// Iterate all connections
 		// Check one by one for all exceptions
-
-		clientsMap := c.GetClients()
-		clients := make(map[uint64]*Client)
-		for client, _ := range clientsMap {
-			// Check in filters
-
-			// So here we should check for each user:
-			/*
-				- Connection ID
-				- User ID
-				- Device ID
-				- IP Address
-				- Request Path
-				- Auth Token
-			*/
-
-			connectionId := client.GetConnectionID()
-
-			// TODO: also we should convert all exception lists to maps for better performance
-			// But if we convert to maps, many will be overwritten... like usernames, auth tokens... that's ok!
-
-			if filter.isExceptDevices {
-				if _, ok := filter.exceptDevicesMap[client.GetDeviceID()]; ok {
-					// If found, then skip it!
-					continue
-				}
-			}
-			if filter.isExceptUsers {
-				if _, ok := filter.exceptUsersMap[client.GetUserID()]; ok {
-					// If found, then skip it!
-					continue
-				}
-			}
-			if filter.isExceptConnections {
-				if _, ok := filter.exceptConnectionsMap[connectionId]; ok {
-					// If found, then skip it!
-					continue
+		c.forEachShard(func(shard *clientsShard) {
+			for client := range shard.clients {
+				if !filter.isExcepted(client) {
+					clients[client.connectionID] = client
 				}
 			}
-			if filter.isExceptIPAddresses {
-				if _, ok := filter.exceptIPAddressesMap[client.GetIPAddress()]; ok {
-					// If found, then skip it!
-					continue
-				}
-			}
-			if filter.isExceptAuthTokens {
-				if _, ok := filter.exceptAuthTokensMap[client.GetAuthToken()]; ok {
-					// If found, then skip it!
-					continue
-				}
-			}
-			if filter.isExceptRequestPaths {
-				if _, ok := filter.exceptRequestPathsMap[client.GetRequestPath()]; ok {
-					// If found, then skip it!
-					continue
-				}
-			}
-			clients[connectionId] = client
-		}
+		})
 		return clients
 	}
 
-	// Check if defined - Users
-	if len(filter.Users) > 0 {
-		awaitGroup.Add(1)
-		nrOfLaunchedSearches++
-		go func() {
-			defer func() {
-				awaitGroup.Done()
-			}()
-			local := make(map[uint64]*Client)
-			for _, userID := range filter.Users {
-				if userID != "" {
-					if filter.isExceptUsers {
-						// Check if it's not excluded
-						if _, ok := filter.exceptUsersMap[userID]; ok {
-							continue
-						}
-					}
-
-					tmpClients := c.GetClientsByUserID(userID)
-					if tmpClients != nil {
-						for connectionID, client := range tmpClients {
-							if _, ok := local[connectionID]; !ok {
-								local[connectionID] = client
-							}
-						}
-					}
-				}
-			}
-			foundClientsChan <- local
-		}()
-	}
-
-	// Devices
-	if len(filter.Devices) > 0 {
-		awaitGroup.Add(1)
-		nrOfLaunchedSearches++
-		go func() {
-			defer func() {
-				awaitGroup.Done()
-			}()
-
-			local := make(map[uint64]*Client)
-			for _, deviceID := range filter.Devices {
-				if deviceID != "" {
-					if filter.isExceptDevices {
-						// Check if it's not excluded
-						if _, ok := filter.exceptDevicesMap[deviceID]; ok {
-							continue
-						}
-					}
-					tmpClients := c.GetClientsByDeviceID(deviceID)
-					if tmpClients != nil {
-						for connectionID, client := range tmpClients {
-							if _, ok := local[connectionID]; !ok {
-								local[connectionID] = client
-							}
-						}
-					}
-				}
-			}
-			foundClientsChan <- local
-		}()
-	}
-
-	// By auth tokens
-	if len(filter.AuthTokens) > 0 {
-		awaitGroup.Add(1)
-		nrOfLaunchedSearches++
-		go func() {
-			defer func() {
-				awaitGroup.Done()
-			}()
-			local := make(map[uint64]*Client)
-			for _, authToken := range filter.AuthTokens {
-				if authToken != "" {
-					if filter.isExceptAuthTokens {
-						// Check if it's not excluded
-						if _, ok := filter.exceptAuthTokensMap[authToken]; ok {
-							continue
-						}
-					}
-					tmpClients := c.GetClientsByAuthToken(authToken)
-					if tmpClients != nil {
-						for connectionID, client := range tmpClients {
-							if _, ok := local[connectionID]; !ok {
-								local[connectionID] = client
-							}
-						}
-					}
-				}
-			}
-			foundClientsChan <- local
-		}()
-
-	}
-
-	// By IP Addresses
-	if len(filter.IPAddresses) > 0 {
-		awaitGroup.Add(1)
-		nrOfLaunchedSearches++
-		go func() {
-			defer func() {
-				awaitGroup.Done()
-			}()
-			local := make(map[uint64]*Client)
-
-			for _, ipAddress := range filter.IPAddresses {
-				if ipAddress != "" {
-					if filter.isExceptIPAddresses {
-						// Check if it's not excluded
-						if _, ok := filter.exceptIPAddressesMap[ipAddress]; ok {
-							continue
-						}
-					}
-					tmpClients := c.GetClientsByIPAddress(ipAddress)
-					if tmpClients != nil {
-						for connectionID, client := range tmpClients {
-							if _, ok := local[connectionID]; !ok {
-								local[connectionID] = client
-							}
-						}
-					}
-				}
-			}
-			foundClientsChan <- local
-		}()
-	}
-
-	// By Route Paths
-	if len(filter.RequestPaths) > 0 {
-		awaitGroup.Add(1)
-		nrOfLaunchedSearches++
-		go func() {
-			defer func() {
-				awaitGroup.Done()
-			}()
-			local := make(map[uint64]*Client)
-
-			for _, requestPath := range filter.RequestPaths {
-				if requestPath != "" {
-					if filter.isExceptRequestPaths {
-						// Check if it's not excluded
-						if _, ok := filter.exceptRequestPathsMap[requestPath]; ok {
-							continue
-						}
-					}
-					tmpClients := c.GetClientsByRequestPath(requestPath)
-					if tmpClients != nil {
-						for connectionID, client := range tmpClients {
-							if _, ok := local[connectionID]; !ok {
-								local[connectionID] = client
-							}
-						}
-					}
-				}
+	// We are searching through 6 indexes!
+	// The exceptions are applied on the same index, as the search itself
+	c.addClientsByIndex(clients, indexUsers, filter.Users, filter.exceptUsersMap)
+	c.addClientsByIndex(clients, indexDevices, filter.Devices, filter.exceptDevicesMap)
+	c.addClientsByIndex(clients, indexAuthTokens, filter.AuthTokens, filter.exceptAuthTokensMap)
+	c.addClientsByIndex(clients, indexIPAddresses, filter.IPAddresses, filter.exceptIPAddressesMap)
+	c.addClientsByIndex(clients, indexRequestPath, filter.RequestPaths, filter.exceptRequestPathsMap)
+	c.addClientsByIndex(clients, indexRooms, filter.Rooms, filter.exceptRoomsMap)
+
+	// By the user-defined indexes
+	for indexName, keys := range filter.Indexes {
+		for _, key := range keys {
+			if key != "" {
+				c.keys.copyInto(clients, indexCustom(indexName), key)
 			}
-			foundClientsChan <- local
-		}()
+		}
 	}
 
 	// By Connection ID's
-	if len(filter.Connections) > 0 {
-		awaitGroup.Add(1)
-		nrOfLaunchedSearches++
-		go func() {
-			defer func() {
-				awaitGroup.Done()
-			}()
-			local := make(map[uint64]*Client)
-
-			for _, connectionID := range filter.Connections {
-				if connectionID != 0 {
-					if filter.isExceptConnections {
-						// Check if it's not excluded
-						if _, ok := filter.exceptConnectionsMap[connectionID]; ok {
-							continue
-						}
-					}
-					tmpClient := c.GetClientByID(connectionID)
-					if tmpClient != nil {
-						if _, ok := local[connectionID]; !ok {
-							local[connectionID] = tmpClient
-						}
-					}
-				}
-			}
-
-			foundClientsChan <- local
-		}()
-	}
-
-	clients := make(map[uint64]*Client)
-	doneAll := make(chan bool)
-	go func() {
-		// Wait for all goroutines to finish
-		awaitGroup.Wait()
-		// Notify the main process that everything has being finished!
-		doneAll <- true
-	}()
-
-	finishedAll := false
-	receivedData := 0
-	for {
-		select {
-		case foundClients := <-foundClientsChan:
-			// Add to clients var
-			receivedData++
-			for connectionID, client := range foundClients {
-				if _, ok := clients[connectionID]; !ok {
-					clients[connectionID] = client
-				}
-			}
-		case <-doneAll:
-			// Break from loop and return clients!
-			finishedAll = true
-		default:
-			if receivedData == nrOfLaunchedSearches {
-				break
-			}
+	for _, connectionID := range filter.Connections {
+		if connectionID == 0 {
+			continue
 		}
-
-		if finishedAll && receivedData == nrOfLaunchedSearches {
-			break
+		// Check if it's not excluded
+		if _, ok := filter.exceptConnectionsMap[connectionID]; ok {
+			continue
+		}
+		if client := c.GetClientByID(connectionID); client != nil {
+			clients[connectionID] = client
 		}
 	}
 
@@ -783,35 +655,26 @@ func (c *clientsData) getClientsByFilter(filter FindClientsFilter) map[uint64]*C
 }
 
 func NewClientsInstance() *clientsData {
-	return &clientsData{
-		// Here we store the c
-		clients: make(map[*Client]bool),
-		// Creating map of ClientsStatus indexes
-		clientsIndex: ClientsIndex{
-			Users:       make(map[string]map[uint64]*Client),
-			Devices:     make(map[string]map[uint64]*Client),
-			Connections: make(map[uint64]*Client),
-			AuthTokens:  make(map[string]map[uint64]*Client),
-			IPAddresses: make(map[string]map[uint64]*Client),
-			RequestPath: make(map[string]map[uint64]*Client),
-		},
+	c := &clientsData{
+		customIndexes: make(map[string]*customClientIndex),
+		keys:          newKeyIndexes(),
+		presence:      newPresenceTracker(),
 		// Allow indexing
 		enableIndexing: true,
 	}
+	for i := range c.shards {
+		c.shards[i] = newClientsShard()
+	}
+	return c
 }
 
+// GetClientsByFilter -> the clients found by the registry, when a ClusterRegistry is set the clients of the
+// other nodes are returned as handles (see Client.IsRemote)
 func (s *Server) GetClientsByFilter(filter FindClientsFilter) map[uint64]*Client {
-	return s.c.getClientsByFilter(filter)
+	return s.GetClientsRegistry().GetClientsByFilter(filter)
 }
 
-func (c *clientsData) GetClientsOrderedByConnectionID() map[int64]*Client {
-	defer func() {
-		c.clientsLock.RUnlock()
-	}()
-	nmap := make(map[int64]*Client)
-	c.clientsLock.RLock()
-	for cl, _ := range c.clients {
-		nmap[int64(cl.connectionID)] = cl
-	}
-	return nmap
+// GetClientsByUserID -> the clients of the user, from all the nodes when a ClusterRegistry is set
+func (s *Server) GetClientsByUserID(userID string) map[uint64]*Client {
+	return s.GetClientsByFilter(FindClientsFilter{Users: []string{userID}})
 }
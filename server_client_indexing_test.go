@@ -0,0 +1,338 @@
+package server
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/kyaxcorp/go-helper/sync/_bool"
+	"github.com/kyaxcorp/go-helper/sync/_map_string_interface"
+	"github.com/kyaxcorp/go-http/middlewares/authentication"
+	"github.com/kyaxcorp/go-http/middlewares/connection"
+)
+
+// clientsPerUser -> the nr. of connections of each user (ex: web, mobile...)
+const clientsPerUser = 4
+
+var benchmarkSizes = []int{1000, 10000, 100000}
+
+// newIndexedClient -> a client which is not bound to a server, it's enough for the registry
+func newIndexedClient(connectionID uint64) *Client {
+	userID := "user-" + strconv.FormatUint(connectionID/clientsPerUser, 10)
+	return &Client{
+		connectionID: connectionID,
+		authDetails: &authentication.AuthDetails{
+			UserDetails:      authentication.UserDetails{UserID: userID},
+			DeviceDetails:    authentication.DeviceDetails{DeviceID: "device-" + strconv.FormatUint(connectionID, 10)},
+			AuthTokenDetails: authentication.AuthTokenDetails{Token: "token-" + strconv.FormatUint(connectionID, 10)},
+		},
+		connDetails: &connection.ConnDetails{
+			ClientIPAddress: "10.0." + strconv.FormatUint(connectionID%250, 10) + ".1",
+			RequestPath:     "/stream",
+		},
+		customData: _map_string_interface.New(),
+		isClosed:   _bool.New(),
+	}
+}
+
+// newIndexedClients -> the connection IDs start from 1, like the ones generated by the server
+func newIndexedClients(from uint64, count int) []*Client {
+	clients := make([]*Client, count)
+	for i := range clients {
+		clients[i] = newIndexedClient(from + uint64(i))
+	}
+	return clients
+}
+
+// newPopulatedClients -> a registry with count clients
+func newPopulatedClients(count int) *clientsData {
+	c := NewClientsInstance()
+	for _, client := range newIndexedClients(1, count) {
+		c.registerClient(client)
+	}
+	return c
+}
+
+func runForSizes(b *testing.B, bench func(b *testing.B, size int)) {
+	for _, size := range benchmarkSizes {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			bench(b, size)
+		})
+	}
+}
+
+func BenchmarkRegister(b *testing.B) {
+	runForSizes(b, func(b *testing.B, size int) {
+		c := newPopulatedClients(size)
+		clients := newIndexedClients(uint64(size)+1, b.N)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for _, client := range clients {
+			c.registerClient(client)
+		}
+	})
+}
+
+func BenchmarkUnregister(b *testing.B) {
+	runForSizes(b, func(b *testing.B, size int) {
+		c := newPopulatedClients(size)
+		clients := newIndexedClients(uint64(size)+1, b.N)
+		for _, client := range clients {
+			c.registerClient(client)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for _, client := range clients {
+			c.unregisterClient(client)
+		}
+	})
+}
+
+func BenchmarkGetClientsByUserID(b *testing.B) {
+	runForSizes(b, func(b *testing.B, size int) {
+		c := newPopulatedClients(size)
+		nrOfUsers := size / clientsPerUser
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if len(c.GetClientsByUserID("user-"+strconv.Itoa(1+i%nrOfUsers))) == 0 {
+				b.Fatal("user not found")
+			}
+		}
+	})
+}
+
+func BenchmarkGetClientsByFilter(b *testing.B) {
+	runForSizes(b, func(b *testing.B, size int) {
+		c := newPopulatedClients(size)
+		nrOfUsers := size / clientsPerUser
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			user := 1 + i%nrOfUsers
+			filter := FindClientsFilter{
+				Users:             []string{"user-" + strconv.Itoa(user), "user-" + strconv.Itoa(1+(user+1)%nrOfUsers)},
+				Devices:           []string{"device-" + strconv.Itoa(1+i%size)},
+				AuthTokens:        []string{"token-" + strconv.Itoa(1+(i+7)%size)},
+				ExceptConnections: []uint64{uint64(user * clientsPerUser)},
+			}
+			if len(c.getClientsByFilter(filter)) == 0 {
+				b.Fatal("no clients found")
+			}
+		}
+	})
+}
+
+// indexedKeysOf -> the keys under which the client should be found, by index name
+func indexedKeysOf(client *Client) map[string][]string {
+	keys := map[string][]string{
+		"users":        {client.GetUserID()},
+		"devices":      {client.GetDeviceID()},
+		"auth_tokens":  {client.GetAuthDetails().AuthTokenDetails.Token},
+		"ip_addresses": {client.connDetails.ClientIPAddress},
+		"request_path": {client.connDetails.RequestPath},
+		"rooms":        client.Rooms(),
+	}
+	client.indexedKeysLock.RLock()
+	for indexName, customKeys := range client.indexedKeys {
+		keys["custom."+indexName] = append([]string{}, customKeys...)
+	}
+	client.indexedKeysLock.RUnlock()
+	return keys
+}
+
+// indexesOf -> the indexes of a ClientsIndex by the names used by indexedKeysOf
+func indexesOf(index *ClientsIndex) map[string]map[string]map[uint64]*Client {
+	indexes := map[string]map[string]map[uint64]*Client{
+		"users":        index.Users,
+		"devices":      index.Devices,
+		"auth_tokens":  index.AuthTokens,
+		"ip_addresses": index.IPAddresses,
+		"request_path": index.RequestPath,
+		"rooms":        index.Rooms,
+	}
+	for indexName, custom := range index.Custom {
+		indexes["custom."+indexName] = custom
+	}
+	return indexes
+}
+
+// checkIndexesConsistency -> the main maps and the indexes should contain exactly the registered clients,
+// each one under its current keys, it should be called when nothing is running
+func checkIndexesConsistency(t *testing.T, c *clientsData) {
+	t.Helper()
+	registered := make(map[*Client]bool)
+	for shardNr, shard := range c.shards {
+		if len(shard.clients) != len(shard.connections) {
+			t.Errorf("shard %d: %d clients but %d connections", shardNr, len(shard.clients), len(shard.connections))
+		}
+		for client := range shard.clients {
+			registered[client] = true
+			if c.getShard(client.connectionID) != shard {
+				t.Errorf("client %d is in the wrong shard %d", client.connectionID, shardNr)
+			}
+			if shard.connections[client.connectionID] != client {
+				t.Errorf("client %d is missing from the connections of shard %d", client.connectionID, shardNr)
+			}
+		}
+	}
+	if int(c.GetNrOfClients()) != len(registered) {
+		t.Errorf("the nr. of clients is %d, but %d are registered", c.GetNrOfClients(), len(registered))
+	}
+
+	// No orphaned entries: each indexed client is registered and it still has the key
+	nrOfEntries := 0
+	for shardNr, shard := range c.keys.shards {
+		for indexName, index := range indexesOf(&shard.index) {
+			for key, clients := range index {
+				if len(clients) == 0 {
+					t.Errorf("%s: the empty key %q has been kept", indexName, key)
+				}
+				if c.keys.shardNr(key) != uint64(shardNr) {
+					t.Errorf("%s: the key %q is in the wrong shard %d", indexName, key, shardNr)
+				}
+				for connectionID, client := range clients {
+					nrOfEntries++
+					if client.connectionID != connectionID || !registered[client] {
+						t.Errorf("%s: orphaned entry %d under %q", indexName, connectionID, key)
+						continue
+					}
+					if !containsString(indexedKeysOf(client)[indexName], key) {
+						t.Errorf("%s: client %d is indexed under the old key %q", indexName, connectionID, key)
+					}
+				}
+			}
+		}
+	}
+
+	// No missing entries: each registered client can be found by each of its keys
+	expectedEntries := 0
+	for client := range registered {
+		for indexName, keys := range indexedKeysOf(client) {
+			for _, key := range keys {
+				if key == "" {
+					continue
+				}
+				expectedEntries++
+				shard := c.keys.shards[c.keys.shardNr(key)]
+				if indexesOf(&shard.index)[indexName][key][client.connectionID] != client {
+					t.Errorf("%s: client %d is missing under %q", indexName, client.connectionID, key)
+				}
+			}
+		}
+	}
+	if nrOfEntries != expectedEntries {
+		t.Errorf("the indexes have %d entries, expected %d", nrOfEntries, expectedEntries)
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSnapshotConsistency -> each client of the indexes should be in the connections of the same snapshot
+func checkSnapshotConsistency(t *testing.T, snapshot ClientsIndex) {
+	for indexName, index := range indexesOf(&snapshot) {
+		for key, clients := range index {
+			for connectionID, client := range clients {
+				if snapshot.Connections[connectionID] != client {
+					t.Errorf("snapshot: %s contains the client %d under %q, but it's not connected", indexName, connectionID, key)
+				}
+			}
+		}
+	}
+}
+
+// TestClientsIndexesConsistency -> run it with -race, the registry is hammered by concurrent
+// registers/unregisters/updates and searches, then the indexes are checked
+func TestClientsIndexesConsistency(t *testing.T) {
+	const writers = 4
+	const clientsPerWriter = 300
+
+	c := NewClientsInstance()
+	if _err := c.RegisterClientIndex("team", func(client *Client) []string {
+		team, _ := client.customData.Get("team").(string)
+		return []string{team}
+	}, "team"); _err != nil {
+		t.Fatal(_err)
+	}
+
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for r := 0; r < 2; r++ {
+		readers.Add(1)
+		go func(r int) {
+			defer readers.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				c.getClientsByFilter(FindClientsFilter{
+					Users:   []string{"user-" + strconv.Itoa(i%50)},
+					Rooms:   []string{"room-" + strconv.Itoa(i%5)},
+					Indexes: map[string][]string{"team": {"team-" + strconv.Itoa(i%3)}},
+				})
+				c.getClientsByFilter(FindClientsFilter{All: true, ExceptRooms: []string{"room-1"}})
+				c.GetRooms()
+				if i%20 == r {
+					checkSnapshotConsistency(t, c.Snapshot())
+				}
+			}
+		}(r)
+	}
+
+	var writersGroup sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		writersGroup.Add(1)
+		go func(w int) {
+			defer writersGroup.Done()
+			for _, client := range newIndexedClients(uint64(w*clientsPerWriter+1), clientsPerWriter) {
+				id := int(client.connectionID)
+				c.registerClient(client)
+				if c.GetClientByID(client.connectionID) != client {
+					t.Errorf("client %d is not found right after registering", id)
+				}
+				if id%2 == 0 {
+					c.joinRoom(client, "room-"+strconv.Itoa(id%5))
+					c.joinRoom(client, "room-"+strconv.Itoa((id+1)%5))
+				}
+				if id%3 == 0 {
+					details := *client.GetAuthDetails()
+					details.UserDetails.UserID = "user-" + strconv.Itoa(id%50)
+					c.updateClientAuthDetails(client, &details)
+				}
+				client.customData.Set("team", "team-"+strconv.Itoa(id%3))
+				c.customDataChanged(client, "team")
+				if id%4 == 0 {
+					c.leaveRoom(client, "room-"+strconv.Itoa(id%5))
+				}
+				// The others remain registered, they are checked at the end
+				if id%5 != 0 {
+					c.unregisterClient(client)
+					if c.GetClientByID(client.connectionID) != nil {
+						t.Errorf("client %d is found after unregistering", id)
+					}
+				}
+			}
+		}(w)
+	}
+	writersGroup.Wait()
+	close(done)
+	readers.Wait()
+
+	checkIndexesConsistency(t, c)
+	if nrOfClients := int(c.GetNrOfClients()); nrOfClients != writers*clientsPerWriter/5 {
+		t.Errorf("expected %d clients, got %d", writers*clientsPerWriter/5, nrOfClients)
+	}
+	checkSnapshotConsistency(t, c.Snapshot())
+	if all := c.getClientsByFilter(FindClientsFilter{All: true}); len(all) != int(c.GetNrOfClients()) {
+		t.Errorf("the filter found %d clients, expected %d", len(all), c.GetNrOfClients())
+	}
+}
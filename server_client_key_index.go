@@ -0,0 +1,155 @@
+package server
+
+import (
+	"hash/maphash"
+	"sync"
+)
+
+// keyIndexShards -> the nr. of shards in which the keys of the indexes are split (by hash of the key)
+// A lookup locks only the shard of its key, so the readers don't wait for all the shards and the writers
+// of the other keys are not blocked by them
+const keyIndexShards = 64
+
+// indexGetter -> returns an index (users, devices, rooms...) from the ClientsIndex of a shard
+type indexGetter func(index *ClientsIndex) map[string]map[uint64]*Client
+
+func indexUsers(index *ClientsIndex) map[string]map[uint64]*Client       { return index.Users }
+func indexDevices(index *ClientsIndex) map[string]map[uint64]*Client     { return index.Devices }
+func indexAuthTokens(index *ClientsIndex) map[string]map[uint64]*Client  { return index.AuthTokens }
+func indexIPAddresses(index *ClientsIndex) map[string]map[uint64]*Client { return index.IPAddresses }
+func indexRequestPath(index *ClientsIndex) map[string]map[uint64]*Client { return index.RequestPath }
+func indexRooms(index *ClientsIndex) map[string]map[uint64]*Client       { return index.Rooms }
+
+// indexCustom -> the user-defined index, it's nil if nothing has been indexed by it in the shard
+func indexCustom(name string) indexGetter {
+	return func(index *ClientsIndex) map[string]map[uint64]*Client {
+		return index.Custom[name]
+	}
+}
+
+// indexCustomForUpdate -> same as indexCustom, but the index is created if it's missing
+func indexCustomForUpdate(name string) indexGetter {
+	return func(index *ClientsIndex) map[string]map[uint64]*Client {
+		custom, ok := index.Custom[name]
+		if !ok {
+			custom = make(map[string]map[uint64]*Client)
+			index.Custom[name] = custom
+		}
+		return custom
+	}
+}
+
+// indexChange -> the client is added to (or removed from) the key of an index
+type indexChange struct {
+	getIndex indexGetter
+	key      string
+	add      bool
+}
+
+// keyIndexShard -> contains the keys (of all the indexes) which hash into it, the Connections are not used
+type keyIndexShard struct {
+	lock  sync.RWMutex
+	index ClientsIndex
+}
+
+type keyIndexes struct {
+	seed   maphash.Seed
+	shards [keyIndexShards]*keyIndexShard
+}
+
+func newKeyIndexes() *keyIndexes {
+	k := &keyIndexes{
+		seed: maphash.MakeSeed(),
+	}
+	for i := range k.shards {
+		k.shards[i] = &keyIndexShard{
+			index: ClientsIndex{
+				Users:       make(map[string]map[uint64]*Client),
+				Devices:     make(map[string]map[uint64]*Client),
+				AuthTokens:  make(map[string]map[uint64]*Client),
+				IPAddresses: make(map[string]map[uint64]*Client),
+				RequestPath: make(map[string]map[uint64]*Client),
+				Rooms:       make(map[string]map[uint64]*Client),
+				Custom:      make(map[string]map[string]map[uint64]*Client),
+			},
+		}
+	}
+	return k
+}
+
+func (k *keyIndexes) shardNr(key string) uint64 {
+	return maphash.String(k.seed, key) % keyIndexShards
+}
+
+// update -> applies the changes (in their order) of a single client
+// All the shards of the keys are locked at once (ascending), in this way the client appears in (or disappears
+// from) all the indexes at once
+// The programmer should hold the lock of the client's clientsShard before!
+func (k *keyIndexes) update(client *Client, changes []indexChange) {
+	var locked [keyIndexShards]bool
+	nrOfLocked := 0
+	for _, change := range changes {
+		if change.key == "" {
+			continue
+		}
+		if shardNr := k.shardNr(change.key); !locked[shardNr] {
+			locked[shardNr] = true
+			nrOfLocked++
+		}
+	}
+	if nrOfLocked == 0 {
+		return
+	}
+	for shardNr, isLocked := range locked {
+		if isLocked {
+			k.shards[shardNr].lock.Lock()
+		}
+	}
+	for _, change := range changes {
+		if change.key == "" {
+			continue
+		}
+		index := change.getIndex(&k.shards[k.shardNr(change.key)].index)
+		if change.add {
+			addToIndex(index, change.key, client)
+		} else {
+			removeFromIndex(index, change.key, client)
+		}
+	}
+	for shardNr, isLocked := range locked {
+		if isLocked {
+			k.shards[shardNr].lock.Unlock()
+		}
+	}
+}
+
+// copyInto -> copies the clients of the key into dst, only the shard of the key is locked
+func (k *keyIndexes) copyInto(dst map[uint64]*Client, getIndex indexGetter, key string) {
+	shard := k.shards[k.shardNr(key)]
+	shard.lock.RLock()
+	copyClientsInto(dst, getIndex(&shard.index)[key])
+	shard.lock.RUnlock()
+}
+
+// get -> returns nil if there are no clients
+func (k *keyIndexes) get(getIndex indexGetter, key string) map[uint64]*Client {
+	shard := k.shards[k.shardNr(key)]
+	shard.lock.RLock()
+	defer shard.lock.RUnlock()
+	clients := getIndex(&shard.index)[key]
+	if len(clients) == 0 {
+		return nil
+	}
+	nmap := make(map[uint64]*Client, len(clients))
+	copyClientsInto(nmap, clients)
+	return nmap
+}
+
+// forEachShard -> calls the function for each shard while holding its read lock
+func (k *keyIndexes) forEachShard(f func(index *ClientsIndex)) {
+	for _, shard := range k.shards {
+		shard.lock.RLock()
+		f(&shard.index)
+		shard.lock.RUnlock()
+	}
+}
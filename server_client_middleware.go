@@ -0,0 +1,168 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kyaxcorp/go-helper/sync/_bool"
+	"github.com/kyaxcorp/go-helper/sync/_map_string_interface"
+	"github.com/kyaxcorp/go-helper/sync/_time"
+	"github.com/kyaxcorp/go-helper/sync/_uint16"
+	"github.com/kyaxcorp/go-helper/sync/_uint64"
+	"github.com/kyaxcorp/go-http/middlewares/authentication"
+	"github.com/kyaxcorp/go-http/middlewares/connection"
+)
+
+const HttpContextClientKey = "HTTP_CLIENT"
+
+func (s *Server) genConnectionID() uint64 {
+	return s.connectionID.Inc(1)
+}
+
+// newClient -> creates the client for the request, it's not registered!
+func (s *Server) newClient(c *gin.Context) *Client {
+	client := s.createClient(authentication.GetAuthDetailsFromCtx(c), connection.GetConnectionDetailsFromCtx(c))
+	client.httpContext = c
+	return client
+}
+
+// createClient -> the client with its own connection ID and counters
+func (s *Server) createClient(authDetails *authentication.AuthDetails, connDetails *connection.ConnDetails) *Client {
+	now := time.Now()
+	return &Client{
+		Logger:          s.Logger,
+		connectTime:     now,
+		connectionID:    s.genConnectionID(),
+		authDetails:     authDetails,
+		connDetails:     connDetails,
+		server:          s,
+		isClosed:        _bool.New(),
+		isDisconnecting: _bool.New(),
+
+		nrOfSentMessages:        _uint64.New(),
+		nrOfSentFailedMessages:  _uint64.New(),
+		nrOfSentSuccessMessages: _uint64.New(),
+		nrOfReceivedMessages:    _uint64.New(),
+		nrOfRequests:            _uint64.New(),
+		bytesIn:                 _uint64.New(),
+		bytesOut:                _uint64.New(),
+		lastActivity:            _time.NewVal(now),
+
+		randomPayloadID: _uint16.New(),
+		customData:      _map_string_interface.New(),
+	}
+}
+
+// clientsMiddleware -> registers a Client for each in-flight request (or long-lived connection)
+// and unregisters it when the request has finished
+// It should be placed after the connection middleware!
+func (s *Server) clientsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client := s.newClient(c)
+		// The request context is canceled when the client is disconnected
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		client.cancel = cancel
+		c.Request = c.Request.WithContext(ctx)
+		// The hijacked connections are closed on disconnect, the written bytes are counted
+		c.Writer = &clientResponseWriter{ResponseWriter: c.Writer, client: client}
+		if c.Request.Body != nil {
+			c.Request.Body = &countingReadCloser{ReadCloser: c.Request.Body, client: client}
+		}
+		client.requestReceived()
+
+		c.Set(HttpContextClientKey, client)
+		// The authentication middleware usually runs later (on the route), when it sets the details we re-index the client
+		// If the session limits reject the client, the auth middleware is told to stop
+		c.Set(authentication.HttpContextOnAuthDetailsKey, authentication.OnAuthDetails(func(details *authentication.AuthDetails) bool {
+			s.setClientAuthDetails(client, details)
+			return s.checkSessionLimits(c, client)
+		}))
+
+		// The details could have been set by a previous middleware, the rejected client is not registered
+		if !s.registerWithinSessionLimits(c, client) {
+			return
+		}
+		s.tokenExpiry.schedule(client, client.GetTokenExpirationTime())
+		// The registry is notified only if the client becomes long-lived (streaming/websocket/hijacked)
+		// On Connect it will be launched in a goroutine!
+		s.onRequest.Scan(func(k string, v interface{}) {
+			go v.(OnRequest)(client, s)
+		})
+
+		defer func() {
+			client.setAsClosed()
+			// Before unregistering, the client still has its rooms
+			// Only the long-lived clients and the disconnected ones are recorded (by default)
+			if s.disconnectHistory.records(client) {
+				s.disconnectHistory.add(newDisconnectedClient(client))
+			}
+			s.c.unregisterClient(client)
+			s.tokenExpiry.unschedule(client)
+			s.registryUnregister(client)
+			s.onResponse.Scan(func(k string, v interface{}) {
+				go v.(OnResponse)(client, s)
+			})
+		}()
+
+		c.Next()
+	}
+}
+
+// GetClientFromCtx -> returns the Client of the current request, nil if the request is not registered
+func GetClientFromCtx(c *gin.Context) *Client {
+	client, ifExists := c.Get(HttpContextClientKey)
+	if !ifExists || client == nil {
+		return nil
+	}
+	return client.(*Client)
+}
+
+// clientResponseWriter -> keeps the hijacked connection, in this way it can be closed on Disconnect
+type clientResponseWriter struct {
+	gin.ResponseWriter
+	client *Client
+}
+
+func (w *clientResponseWriter) Write(data []byte) (int, error) {
+	n, _err := w.ResponseWriter.Write(data)
+	w.client.addBytesOut(n)
+	return n, _err
+}
+
+func (w *clientResponseWriter) WriteString(data string) (int, error) {
+	n, _err := w.ResponseWriter.WriteString(data)
+	w.client.addBytesOut(n)
+	return n, _err
+}
+
+func (w *clientResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, _err := w.ResponseWriter.Hijack()
+	if _err == nil {
+		w.client.addCloser(conn.Close)
+		w.client.sendLock.Lock()
+		becameLongLived := w.client.setKind(ClientKindHijacked)
+		w.client.sendLock.Unlock()
+		if becameLongLived {
+			w.client.longLived()
+		}
+	}
+	return conn, rw, _err
+}
+
+// DisconnectClients -> disconnects the clients of this node found by the filter, it returns the nr. of
+// disconnected clients
+func (s *Server) DisconnectClients(filter FindClientsFilter, reason string) int {
+	nrOfDisconnected := 0
+	for _, client := range s.c.getClientsByFilter(filter) {
+		if client.IsDisconnecting() {
+			continue
+		}
+		_ = client.Disconnect(reason)
+		nrOfDisconnected++
+	}
+	return nrOfDisconnected
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kyaxcorp/go-helper/errors2/define"
+)
+
+// ClientsSort -> the order in which the clients are listed
+// Clients with the same value are ordered by connection ID, in this way the order is always stable
+type ClientsSort string
+
+const (
+	ClientsSortConnectionID ClientsSort = "connection_id"
+	ClientsSortConnectTime  ClientsSort = "connect_time"
+	ClientsSortUser         ClientsSort = "user"
+	ClientsSortIP           ClientsSort = "ip"
+)
+
+// IsValidClientsSort -> checks if the sort is known, an empty sort means ClientsSortConnectionID
+func IsValidClientsSort(sortBy ClientsSort) bool {
+	switch sortBy {
+	case "", ClientsSortConnectionID, ClientsSortConnectTime, ClientsSortUser, ClientsSortIP:
+		return true
+	}
+	return false
+}
+
+// ClientsPageOptions -> which clients should be listed and how
+type ClientsPageOptions struct {
+	// Query -> if nil, all the clients are listed
+	Query *ClientQuery
+	Sort  ClientsSort
+	// Limit -> the max nr. of clients in the page, 0 means no limit
+	Limit int
+	// After -> the cursor returned by the previous page (ClientsPage.NextCursor)
+	After string
+}
+
+// ClientsPage -> a page of clients
+type ClientsPage struct {
+	Clients []*Client
+	// NextCursor -> it's empty when there are no more clients
+	NextCursor string
+}
+
+// sortedClient -> the client together with the value by which it's sorted
+type sortedClient struct {
+	key    string
+	client *Client
+}
+
+func (c sortedClient) less(key string, connectionID uint64) bool {
+	if c.key != key {
+		return c.key < key
+	}
+	return c.client.connectionID < connectionID
+}
+
+// clientSortKey -> returns a value which can be compared as a string
+func clientSortKey(client *Client, sortBy ClientsSort) string {
+	switch sortBy {
+	case ClientsSortConnectTime:
+		return fmt.Sprintf("%020d", client.connectTime.UnixNano())
+	case ClientsSortUser:
+		return client.GetUserID()
+	case ClientsSortIP:
+		// The ip addresses are compared by their bytes, the ones which can't be parsed are placed at the end
+		ipAddress := client.GetIPAddress()
+		if ip := net.ParseIP(ipAddress); ip != nil {
+			return hex.EncodeToString(ip.To16())
+		}
+		return "~" + ipAddress
+	default:
+		// The connection ID is also the tie-breaker
+		return ""
+	}
+}
+
+func sortClients(clients map[uint64]*Client, sortBy ClientsSort) []sortedClient {
+	sorted := make([]sortedClient, 0, len(clients))
+	for _, client := range clients {
+		sorted = append(sorted, sortedClient{
+			key:    clientSortKey(client, sortBy),
+			client: client,
+		})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].less(sorted[j].key, sorted[j].client.connectionID)
+	})
+	return sorted
+}
+
+func encodeClientsCursor(c sortedClient) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(
+		strconv.FormatUint(c.client.connectionID, 10) + ":" + c.key,
+	))
+}
+
+func decodeClientsCursor(cursor string) (key string, connectionID uint64, _err error) {
+	decoded, _err := base64.RawURLEncoding.DecodeString(cursor)
+	if _err != nil {
+		return "", 0, define.Err(0, "invalid clients cursor", cursor)
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", 0, define.Err(0, "invalid clients cursor", cursor)
+	}
+	connectionID, _err = strconv.ParseUint(parts[0], 10, 64)
+	if _err != nil {
+		return "", 0, define.Err(0, "invalid clients cursor", cursor)
+	}
+	return parts[1], connectionID, nil
+}
+
+// GetClientsSorted -> returns all the clients as an ordered list
+func (c *clientsData) GetClientsSorted(sortBy ClientsSort) []*Client {
+	sorted := sortClients(c.GetClientsList(), sortBy)
+	clients := make([]*Client, len(sorted))
+	for i, sc := range sorted {
+		clients[i] = sc.client
+	}
+	return clients
+}
+
+// GetClientsOrderedByConnectionID -> returns all the clients by connection ID
+// The map has no order, use GetClientsSortedByConnectionID for an ordered list
+func (c *clientsData) GetClientsOrderedByConnectionID() map[int64]*Client {
+	clients := c.GetClientsList()
+	nmap := make(map[int64]*Client, len(clients))
+	for connectionID, client := range clients {
+		nmap[int64(connectionID)] = client
+	}
+	return nmap
+}
+
+// GetClientsSortedByConnectionID -> returns all the clients ordered by connection ID
+func (c *clientsData) GetClientsSortedByConnectionID() []*Client {
+	return c.GetClientsSorted(ClientsSortConnectionID)
+}
+
+// GetClientsPage -> returns the clients matching the query, ordered and paginated
+// The cursor is based on the sort value and the connection ID, so the clients which connect or disconnect
+// between the calls don't shift the pages
+func (c *clientsData) GetClientsPage(options ClientsPageOptions) (ClientsPage, error) {
+	if !IsValidClientsSort(options.Sort) {
+		return ClientsPage{}, define.Err(0, "invalid clients sort", string(options.Sort))
+	}
+	if options.Limit < 0 {
+		return ClientsPage{}, define.Err(0, "invalid clients limit", strconv.Itoa(options.Limit))
+	}
+
+	var clients map[uint64]*Client
+	if options.Query == nil {
+		clients = c.GetClientsList()
+	} else {
+		clients = c.find(options.Query)
+	}
+	sorted := sortClients(clients, options.Sort)
+
+	start := 0
+	if options.After != "" {
+		key, connectionID, _err := decodeClientsCursor(options.After)
+		if _err != nil {
+			return ClientsPage{}, _err
+		}
+		// The first one which is after the cursor
+		start = sort.Search(len(sorted), func(i int) bool {
+			return !sorted[i].less(key, connectionID) &&
+				!(sorted[i].key == key && sorted[i].client.connectionID == connectionID)
+		})
+	}
+
+	end := len(sorted)
+	if options.Limit > 0 && start+options.Limit < end {
+		end = start + options.Limit
+	}
+
+	page := ClientsPage{
+		Clients: make([]*Client, 0, end-start),
+	}
+	for _, sc := range sorted[start:end] {
+		page.Clients = append(page.Clients, sc.client)
+	}
+	if end < len(sorted) && end > start {
+		page.NextCursor = encodeClientsCursor(sorted[end-1])
+	}
+	return page, nil
+}
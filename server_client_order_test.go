@@ -0,0 +1,31 @@
+package server
+
+import "testing"
+
+func TestClientsOrderedByConnectionID(t *testing.T) {
+	c := NewClientsInstance()
+	for _, connectionID := range []uint64{7, 3, 12, 1, 5} {
+		c.registerClient(newIndexedClient(connectionID))
+	}
+
+	byID := c.GetClientsOrderedByConnectionID()
+	if len(byID) != 5 {
+		t.Fatalf("expected 5 clients, got %d", len(byID))
+	}
+	for connectionID, client := range byID {
+		if uint64(connectionID) != client.connectionID {
+			t.Errorf("client %d is under the key %d", client.connectionID, connectionID)
+		}
+	}
+
+	sorted := c.GetClientsSortedByConnectionID()
+	expected := []uint64{1, 3, 5, 7, 12}
+	if len(sorted) != len(expected) {
+		t.Fatalf("expected %d clients, got %d", len(expected), len(sorted))
+	}
+	for i, client := range sorted {
+		if client.connectionID != expected[i] {
+			t.Errorf("position %d: expected the client %d, got %d", i, expected[i], client.connectionID)
+		}
+	}
+}
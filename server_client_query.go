@@ -0,0 +1,384 @@
+package server
+
+import (
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/kyaxcorp/go-helper/errors2/define"
+)
+
+type queryOp uint8
+
+const (
+	queryLeaf queryOp = iota
+	queryAnd
+	queryOr
+	queryNot
+)
+
+// ClientQuery -> a condition over the clients, which can be combined with And/Or/Not
+// The conditions on Users, Devices, AuthTokens, Connections, IP Addresses, Request Paths and Rooms are searched
+// through the indexes, the others are checked client by client
+//
+//	query := server.And(
+//		server.QueryUsers("x"),
+//		server.QueryDevices("y"),
+//	)
+//	clients := s.FindClients(query)
+type ClientQuery struct {
+	op       queryOp
+	children []*ClientQuery
+
+	// match -> checks the client, it's set only for the leafs
+	match func(client *Client) bool
+	// lookup -> returns the clients from the indexes, it's nil if the leaf can't use the indexes
+	lookup func(c *clientsData) map[uint64]*Client
+}
+
+// orAll -> a nil query matches all the clients (same as QueryAll)
+func orAll(query *ClientQuery) *ClientQuery {
+	if query == nil {
+		return QueryAll()
+	}
+	return query
+}
+
+// orAllQueries -> the nil queries are replaced by QueryAll, the given slice is not modified
+func orAllQueries(queries []*ClientQuery) []*ClientQuery {
+	children := make([]*ClientQuery, len(queries))
+	for i, query := range queries {
+		children[i] = orAll(query)
+	}
+	return children
+}
+
+// And -> the client should match all the queries, a nil query matches all the clients
+func And(queries ...*ClientQuery) *ClientQuery {
+	return &ClientQuery{op: queryAnd, children: orAllQueries(queries)}
+}
+
+// Or -> the client should match at least one of the queries, a nil query matches all the clients
+func Or(queries ...*ClientQuery) *ClientQuery {
+	return &ClientQuery{op: queryOr, children: orAllQueries(queries)}
+}
+
+// Not -> the client should not match the query, Not(nil) matches no client
+func Not(query *ClientQuery) *ClientQuery {
+	return &ClientQuery{op: queryNot, children: []*ClientQuery{orAll(query)}}
+}
+
+// And -> same as And(q, queries...)
+func (q *ClientQuery) And(queries ...*ClientQuery) *ClientQuery {
+	return And(append([]*ClientQuery{q}, queries...)...)
+}
+
+// Or -> same as Or(q, queries...)
+func (q *ClientQuery) Or(queries ...*ClientQuery) *ClientQuery {
+	return Or(append([]*ClientQuery{q}, queries...)...)
+}
+
+// Not -> same as Not(q)
+func (q *ClientQuery) Not() *ClientQuery {
+	return Not(q)
+}
+
+// Matches -> checks if the client matches the query, a nil query matches all the clients
+func (q *ClientQuery) Matches(client *Client) bool {
+	if q == nil {
+		return true
+	}
+	switch q.op {
+	case queryAnd:
+		for _, child := range q.children {
+			if !child.Matches(client) {
+				return false
+			}
+		}
+		return true
+	case queryOr:
+		for _, child := range q.children {
+			if child.Matches(client) {
+				return true
+			}
+		}
+		return false
+	case queryNot:
+		return !q.children[0].Matches(client)
+	default:
+		return q.match(client)
+	}
+}
+
+//-------------------------------------\\
+
+// QueryAll -> matches all the clients
+func QueryAll() *ClientQuery {
+	return QueryPredicate(func(client *Client) bool {
+		return true
+	})
+}
+
+// QueryPredicate -> matches the clients for which the predicate returns true
+func QueryPredicate(predicate func(client *Client) bool) *ClientQuery {
+	return &ClientQuery{match: predicate}
+}
+
+// indexedQuery -> a leaf which can be searched through an index
+func indexedQuery(
+	keys []string,
+	getIndex func(index *ClientsIndex) map[string]map[uint64]*Client,
+	getKey func(client *Client) string,
+) *ClientQuery {
+	keysMap := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if key != "" {
+			keysMap[key] = true
+		}
+	}
+	return &ClientQuery{
+		match: func(client *Client) bool {
+			return keysMap[getKey(client)]
+		},
+		lookup: func(c *clientsData) map[uint64]*Client {
+			clients := make(map[uint64]*Client)
+			for key := range keysMap {
+				copyClientsInto(clients, c.getClientsByIndex(getIndex, key))
+			}
+			return clients
+		},
+	}
+}
+
+// QueryUsers -> matches the clients of the users
+func QueryUsers(userIDs ...string) *ClientQuery {
+	return indexedQuery(userIDs, indexUsers, (*Client).GetUserID)
+}
+
+// QueryDevices -> matches the clients of the devices
+func QueryDevices(deviceIDs ...string) *ClientQuery {
+	return indexedQuery(deviceIDs, indexDevices, (*Client).GetDeviceID)
+}
+
+// QueryAuthTokens -> matches the clients authenticated with the tokens
+func QueryAuthTokens(authTokens ...string) *ClientQuery {
+	return indexedQuery(authTokens, indexAuthTokens, (*Client).GetAuthToken)
+}
+
+// QueryIPAddresses -> matches the clients with the exact ip addresses
+func QueryIPAddresses(ipAddresses ...string) *ClientQuery {
+	return indexedQuery(ipAddresses, indexIPAddresses, (*Client).GetIPAddress)
+}
+
+// QueryRequestPaths -> matches the clients with the exact request paths
+func QueryRequestPaths(requestPaths ...string) *ClientQuery {
+	return indexedQuery(requestPaths, indexRequestPath, (*Client).GetRequestPath)
+}
+
+// QueryRooms -> matches the clients which have joined one of the rooms
+func QueryRooms(rooms ...string) *ClientQuery {
+	q := indexedQuery(rooms, indexRooms, nil)
+	roomsMap := make(map[string]bool, len(rooms))
+	for _, room := range rooms {
+		roomsMap[room] = true
+	}
+	// A client can be in many rooms
+	q.match = func(client *Client) bool {
+		for _, room := range client.Rooms() {
+			if roomsMap[room] {
+				return true
+			}
+		}
+		return false
+	}
+	return q
+}
+
+// QueryConnections -> matches the clients with the connection ID's
+func QueryConnections(connectionIDs ...uint64) *ClientQuery {
+	connectionsMap := make(map[uint64]bool, len(connectionIDs))
+	for _, connectionID := range connectionIDs {
+		connectionsMap[connectionID] = true
+	}
+	return &ClientQuery{
+		match: func(client *Client) bool {
+			return connectionsMap[client.connectionID]
+		},
+		lookup: func(c *clientsData) map[uint64]*Client {
+			clients := make(map[uint64]*Client, len(connectionsMap))
+			for connectionID := range connectionsMap {
+				if client := c.GetClientByID(connectionID); client != nil {
+					clients[connectionID] = client
+				}
+			}
+			return clients
+		},
+	}
+}
+
+// QueryRequestPathPrefix -> matches the clients whose request path starts with the prefix
+func QueryRequestPathPrefix(prefix string) *ClientQuery {
+	return QueryPredicate(func(client *Client) bool {
+		return strings.HasPrefix(client.GetRequestPath(), prefix)
+	})
+}
+
+// QueryRequestPathGlob -> matches the clients whose request path matches the pattern (see path.Match)
+func QueryRequestPathGlob(pattern string) (*ClientQuery, error) {
+	// Checking the pattern before, path.Match returns the error only when reaching the bad part
+	if _, _err := path.Match(pattern, ""); _err != nil {
+		return nil, define.Err(0, "invalid request path pattern", pattern, _err.Error())
+	}
+	return QueryPredicate(func(client *Client) bool {
+		matched, _ := path.Match(pattern, client.GetRequestPath())
+		return matched
+	}), nil
+}
+
+// QueryCIDR -> matches the clients whose ip address is in one of the networks
+func QueryCIDR(cidrs ...string) (*ClientQuery, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, _err := net.ParseCIDR(cidr)
+		if _err != nil {
+			return nil, define.Err(0, "invalid cidr", cidr, _err.Error())
+		}
+		networks = append(networks, network)
+	}
+	return QueryPredicate(func(client *Client) bool {
+		ip := net.ParseIP(client.GetIPAddress())
+		if ip == nil {
+			return false
+		}
+		for _, network := range networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+// QueryConnectedBetween -> matches the clients connected in the interval, a zero time means no limit
+func QueryConnectedBetween(from time.Time, to time.Time) *ClientQuery {
+	return QueryPredicate(func(client *Client) bool {
+		if !from.IsZero() && client.connectTime.Before(from) {
+			return false
+		}
+		if !to.IsZero() && client.connectTime.After(to) {
+			return false
+		}
+		return true
+	})
+}
+
+// QueryConnectedLongerThan -> matches the clients connected for at least the duration
+func QueryConnectedLongerThan(duration time.Duration) *ClientQuery {
+	return QueryPredicate(func(client *Client) bool {
+		return time.Since(client.connectTime) >= duration
+	})
+}
+
+// QueryRoles -> matches the clients whose user has one of the roles
+func QueryRoles(roles ...string) *ClientQuery {
+	return stringsQuery(roles, func(client *Client) string {
+		return client.GetAuthDetails().GetRoleStr()
+	})
+}
+
+// QueryUserTypes -> matches the clients whose user has one of the types
+func QueryUserTypes(userTypes ...string) *ClientQuery {
+	return stringsQuery(userTypes, func(client *Client) string {
+		return client.GetAuthDetails().GetUserTypeStr()
+	})
+}
+
+func stringsQuery(values []string, getValue func(client *Client) string) *ClientQuery {
+	valuesMap := make(map[string]bool, len(values))
+	for _, value := range values {
+		valuesMap[value] = true
+	}
+	return QueryPredicate(func(client *Client) bool {
+		return valuesMap[getValue(client)]
+	})
+}
+
+// QueryCustomData -> matches the clients for which the predicate returns true on the custom data (see Client.Set)
+func QueryCustomData(key string, predicate func(value interface{}) bool) *ClientQuery {
+	return QueryPredicate(func(client *Client) bool {
+		return predicate(client.Get(key))
+	})
+}
+
+//-------------------------------------\\
+
+// find -> returns the clients matching the query
+// If the query can't be answered by the indexes, all the clients are checked
+func (c *clientsData) find(q *ClientQuery) map[uint64]*Client {
+	q = orAll(q)
+	if clients, ok := c.findIndexed(q); ok {
+		return clients
+	}
+	clients := make(map[uint64]*Client)
+	c.forEachShard(func(shard *clientsShard) {
+		for client := range shard.clients {
+			if q.Matches(client) {
+				clients[client.connectionID] = client
+			}
+		}
+	})
+	return clients
+}
+
+// findIndexed -> returns the exact result if the query can be answered by the indexes
+func (c *clientsData) findIndexed(q *ClientQuery) (map[uint64]*Client, bool) {
+	switch q.op {
+	case queryAnd:
+		// The smallest indexed part gives the candidates, the others are checked on them
+		var candidates map[uint64]*Client
+		found := false
+		for _, child := range q.children {
+			clients, ok := c.findIndexed(child)
+			if !ok {
+				continue
+			}
+			if !found || len(clients) < len(candidates) {
+				candidates = clients
+				found = true
+			}
+		}
+		if !found {
+			return nil, false
+		}
+		for connectionID, client := range candidates {
+			if !q.Matches(client) {
+				delete(candidates, connectionID)
+			}
+		}
+		return candidates, true
+	case queryOr:
+		// All the parts should be indexed, otherwise we should scan anyway
+		clients := make(map[uint64]*Client)
+		for _, child := range q.children {
+			childClients, ok := c.findIndexed(child)
+			if !ok {
+				return nil, false
+			}
+			copyClientsInto(clients, childClients)
+		}
+		return clients, true
+	case queryNot:
+		return nil, false
+	default:
+		if q.lookup == nil {
+			return nil, false
+		}
+		return q.lookup(c), true
+	}
+}
+
+// FindClients -> returns the clients matching the query
+func (s *Server) FindClients(q *ClientQuery) map[uint64]*Client {
+	return s.c.find(q)
+}
@@ -0,0 +1,42 @@
+package server
+
+import "testing"
+
+// TestNilQueries -> a nil query matches all the clients, it doesn't panic
+func TestNilQueries(t *testing.T) {
+	c := NewClientsInstance()
+	for _, client := range newIndexedClients(1, 8) {
+		c.registerClient(client)
+	}
+	// The connections 4..7 are of user-1
+	userQuery := QueryUsers("user-1")
+
+	tests := []struct {
+		name     string
+		query    *ClientQuery
+		expected int
+	}{
+		{"nil", nil, 8},
+		{"not nil", Not(nil), 0},
+		{"and with nil", And(nil, userQuery), 4},
+		{"or with nil", Or(userQuery, nil), 8},
+		{"not of and with nil", Not(And(userQuery, nil)), 4},
+		{"nil receiver", (*ClientQuery)(nil).And(userQuery), 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if found := len(c.find(test.query)); found != test.expected {
+				t.Errorf("expected %d clients, found %d", test.expected, found)
+			}
+			matched := 0
+			for client := range c.GetClients() {
+				if test.query.Matches(client) {
+					matched++
+				}
+			}
+			if matched != test.expected {
+				t.Errorf("expected %d matching clients, got %d", test.expected, matched)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import "sort"
+
+// Join -> the client joins the room, it's indexed in ClientsIndex.Rooms (the remote clients are skipped)
+// The client leaves all the rooms when it's unregistered
+func (c *Client) Join(room string) *Client {
+	if room != "" && c.server != nil && c.remote == nil {
+		c.server.c.joinRoom(c, room)
+		c.server.roomsChanged(c)
+	}
+	return c
+}
+
+// Leave -> the client leaves the room
+func (c *Client) Leave(room string) *Client {
+	if room != "" && c.server != nil && c.remote == nil {
+		c.server.c.leaveRoom(c, room)
+		c.server.roomsChanged(c)
+	}
+	return c
+}
+
+// Rooms -> the rooms joined by the client (sorted)
+func (c *Client) Rooms() []string {
+	c.roomsLock.RLock()
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+	c.roomsLock.RUnlock()
+	sort.Strings(rooms)
+	return rooms
+}
+
+// InRoom -> checks if the client has joined the room
+func (c *Client) InRoom(room string) bool {
+	c.roomsLock.RLock()
+	defer c.roomsLock.RUnlock()
+	return c.rooms[room]
+}
+
+// setRoom -> returns false if the membership hasn't changed
+func (c *Client) setRoom(room string, joined bool) bool {
+	c.roomsLock.Lock()
+	defer c.roomsLock.Unlock()
+	if c.rooms[room] == joined {
+		return false
+	}
+	if joined {
+		if c.rooms == nil {
+			c.rooms = make(map[string]bool)
+		}
+		c.rooms[room] = true
+	} else {
+		delete(c.rooms, room)
+	}
+	return true
+}
+
+// leaveAllRooms -> returns the rooms which have been left
+func (c *Client) leaveAllRooms() []string {
+	c.roomsLock.Lock()
+	defer c.roomsLock.Unlock()
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+	c.rooms = nil
+	return rooms
+}
+
+// roomsChanged -> the registry is updated with the rooms of the client
+func (s *Server) roomsChanged(client *Client) {
+	if client.isClosed.Get() {
+		return
+	}
+	s.registryRegister(client)
+}
+
+func (c *clientsData) joinRoom(client *Client, room string) {
+	shard := c.getShard(client.connectionID)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	registered := shard.clients[client]
+	if !registered && client.isClosed.Get() {
+		// It has been unregistered, nobody would clean the membership
+		return
+	}
+	if !client.setRoom(room, true) {
+		return
+	}
+	if registered && c.enableIndexing {
+		c.keys.update(client, []indexChange{{getIndex: indexRooms, key: room, add: true}})
+	}
+}
+
+func (c *clientsData) leaveRoom(client *Client, room string) {
+	shard := c.getShard(client.connectionID)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	if !client.setRoom(room, false) {
+		return
+	}
+	c.keys.update(client, []indexChange{{getIndex: indexRooms, key: room}})
+}
+
+// GetRoomMembers -> the clients which have joined the room
+func (c *clientsData) GetRoomMembers(room string) map[uint64]*Client {
+	return c.getClientsByIndex(indexRooms, room)
+}
+
+// GetRooms -> the nr. of clients by room
+func (c *clientsData) GetRooms() map[string]int {
+	rooms := make(map[string]int)
+	c.keys.forEachShard(func(index *ClientsIndex) {
+		for room, clients := range index.Rooms {
+			rooms[room] += len(clients)
+		}
+	})
+	return rooms
+}
+
+func (s *Server) RoomMembers(room string) map[uint64]*Client {
+	return s.c.GetRoomMembers(room)
+}
+
+// Rooms -> the nr. of clients by room
+func (s *Server) Rooms() map[string]int {
+	return s.c.GetRooms()
+}
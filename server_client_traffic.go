@@ -0,0 +1,137 @@
+package server
+
+import (
+	"io"
+	"time"
+
+	"github.com/kyaxcorp/go-helper/sync/_uint64"
+)
+
+// serverTraffic -> the totals of all the clients (including the disconnected ones)
+type serverTraffic struct {
+	nrOfRequests           *_uint64.Uint64
+	bytesIn                *_uint64.Uint64
+	bytesOut               *_uint64.Uint64
+	nrOfReceivedMessages   *_uint64.Uint64
+	nrOfSentMessages       *_uint64.Uint64
+	nrOfSentFailedMessages *_uint64.Uint64
+}
+
+func newServerTraffic() serverTraffic {
+	return serverTraffic{
+		nrOfRequests:           _uint64.New(),
+		bytesIn:                _uint64.New(),
+		bytesOut:               _uint64.New(),
+		nrOfReceivedMessages:   _uint64.New(),
+		nrOfSentMessages:       _uint64.New(),
+		nrOfSentFailedMessages: _uint64.New(),
+	}
+}
+
+// TrafficStatus -> the server-wide totals, since the server has been created
+type TrafficStatus struct {
+	NrOfRequests           uint64
+	BytesIn                uint64
+	BytesOut               uint64
+	NrOfReceivedMessages   uint64
+	NrOfSentMessages       uint64
+	NrOfSentFailedMessages uint64
+}
+
+func (s *Server) GetTrafficStatus() TrafficStatus {
+	return TrafficStatus{
+		NrOfRequests:           s.traffic.nrOfRequests.Get(),
+		BytesIn:                s.traffic.bytesIn.Get(),
+		BytesOut:               s.traffic.bytesOut.Get(),
+		NrOfReceivedMessages:   s.traffic.nrOfReceivedMessages.Get(),
+		NrOfSentMessages:       s.traffic.nrOfSentMessages.Get(),
+		NrOfSentFailedMessages: s.traffic.nrOfSentFailedMessages.Get(),
+	}
+}
+
+//-------------------------------------\\
+
+func (c *Client) addBytesIn(n int) {
+	c.bytesIn.Inc(uint64(n))
+	c.server.traffic.bytesIn.Inc(uint64(n))
+	c.lastActivity.SetNow()
+}
+
+func (c *Client) addBytesOut(n int) {
+	c.bytesOut.Inc(uint64(n))
+	c.server.traffic.bytesOut.Inc(uint64(n))
+	c.lastActivity.SetNow()
+}
+
+// requestReceived -> the http request of the client, the server counts only the http requests
+func (c *Client) requestReceived() {
+	c.nrOfRequests.Inc(1)
+	c.server.traffic.nrOfRequests.Inc(1)
+}
+
+// messageReceived -> a websocket message has been received, for the client it's counted as a request too
+func (c *Client) messageReceived(size int) {
+	c.nrOfRequests.Inc(1)
+	c.nrOfReceivedMessages.Inc(1)
+	c.server.traffic.nrOfReceivedMessages.Inc(1)
+	c.addBytesIn(size)
+}
+
+// messageQueued -> a message has been queued for the client (SSE/WebSocket)
+func (c *Client) messageQueued() {
+	c.nrOfSentMessages.Inc(1)
+	c.server.traffic.nrOfSentMessages.Inc(1)
+}
+
+// messageDuplicated -> the queued message won't be written, it has been already sent (ex: replayed SSE event)
+func (c *Client) messageDuplicated() {
+	c.nrOfSentMessages.Dec(1)
+	c.server.traffic.nrOfSentMessages.Dec(1)
+}
+
+// messageSent -> the queued message has been written
+func (c *Client) messageSent() {
+	c.nrOfSentSuccessMessages.Inc(1)
+}
+
+// messageFailed -> the queued message has been dropped or it couldn't be written
+func (c *Client) messageFailed() {
+	c.nrOfSentFailedMessages.Inc(1)
+	c.server.traffic.nrOfSentFailedMessages.Inc(1)
+}
+
+// GetNrOfRequests -> the http request and the websocket messages received from the client
+func (c *Client) GetNrOfRequests() uint64 {
+	return c.nrOfRequests.Get()
+}
+
+func (c *Client) GetBytesIn() uint64 {
+	return c.bytesIn.Get()
+}
+
+func (c *Client) GetBytesOut() uint64 {
+	return c.bytesOut.Get()
+}
+
+func (c *Client) GetNrOfReceivedMessages() uint64 {
+	return c.nrOfReceivedMessages.Get()
+}
+
+// GetLastActivity -> the last time when something has been read from/written to the client
+func (c *Client) GetLastActivity() time.Time {
+	return c.lastActivity.Get()
+}
+
+// countingReadCloser -> counts the bytes of the request body
+type countingReadCloser struct {
+	io.ReadCloser
+	client *Client
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, _err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.client.addBytesIn(n)
+	}
+	return n, _err
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kyaxcorp/go-helper/errors2/define"
+	"github.com/kyaxcorp/go-http/middlewares/authentication"
+	"github.com/kyaxcorp/go-http/middlewares/connection"
+)
+
+// ClusterClient -> the description of a client, which can be connected to this node or to another one
+// The auth token is not shared between the nodes, the remote clients don't match FindClientsFilter.AuthTokens
+// and FindClientsFilter.Indexes
+type ClusterClient struct {
+	NodeID string `json:"node_id"`
+	// ConnectionID -> it's unique only on its node
+	ConnectionID uint64    `json:"connection_id"`
+	UserID       string    `json:"user_id,omitempty"`
+	DeviceID     string    `json:"device_id,omitempty"`
+	IPAddress    string    `json:"ip_address,omitempty"`
+	RequestPath  string    `json:"request_path,omitempty"`
+	JoinedRooms  []string  `json:"rooms,omitempty"`
+	ConnectTime  time.Time `json:"connect_time"`
+	// Kind -> only the long-lived clients are published to the other nodes
+	Kind ClientKind `json:"kind,omitempty"`
+
+	// client -> it's set only for the local clients
+	client *Client
+}
+
+func (cc ClusterClient) GetConnectionID() uint64 {
+	return cc.ConnectionID
+}
+
+func (cc ClusterClient) GetUserID() string {
+	return cc.UserID
+}
+
+func (cc ClusterClient) GetDeviceID() string {
+	return cc.DeviceID
+}
+
+func (cc ClusterClient) GetAuthToken() string {
+	if cc.client != nil {
+		return cc.client.GetAuthToken()
+	}
+	return ""
+}
+
+func (cc ClusterClient) GetIPAddress() string {
+	return cc.IPAddress
+}
+
+func (cc ClusterClient) GetRequestPath() string {
+	return cc.RequestPath
+}
+
+func (cc ClusterClient) Rooms() []string {
+	return cc.JoinedRooms
+}
+
+func (cc ClusterClient) hasIndexedKey(indexName string, key string) bool {
+	if cc.client != nil {
+		return cc.client.hasIndexedKey(indexName, key)
+	}
+	return false
+}
+
+// IsLocal -> checks if the client is connected to this node
+func (cc ClusterClient) IsLocal() bool {
+	return cc.client != nil
+}
+
+// GetClient -> the local client, nil if it's connected to another node
+func (cc ClusterClient) GetClient() *Client {
+	return cc.client
+}
+
+// newClusterClient -> describes the local client
+func newClusterClient(nodeID string, client *Client) ClusterClient {
+	return ClusterClient{
+		NodeID:       nodeID,
+		ConnectionID: client.connectionID,
+		UserID:       client.GetUserID(),
+		DeviceID:     client.GetDeviceID(),
+		IPAddress:    client.GetIPAddress(),
+		RequestPath:  client.GetRequestPath(),
+		JoinedRooms:  client.Rooms(),
+		ConnectTime:  client.connectTime,
+		Kind:         client.GetKind(),
+		client:       client,
+	}
+}
+
+// newRemoteClient -> the handle of a client connected to another node, it has its own connection ID on this
+// node (the connection ID's are unique only on their node), the original one is kept in the description
+func newRemoteClient(s *Server, remote ClusterClient, connectionID uint64) *Client {
+	client := s.createClient(
+		&authentication.AuthDetails{
+			UserDetails:   authentication.UserDetails{UserID: remote.UserID},
+			DeviceDetails: authentication.DeviceDetails{DeviceID: remote.DeviceID},
+		},
+		&connection.ConnDetails{ClientIPAddress: remote.IPAddress, RequestPath: remote.RequestPath},
+	)
+	if connectionID != 0 {
+		client.connectionID = connectionID
+	}
+	client.connectTime = remote.ConnectTime
+	client.kind = remote.Kind
+	client.remote = &remote
+	for _, room := range remote.JoinedRooms {
+		client.setRoom(room, true)
+	}
+	return client
+}
+
+// IsRemote -> the client is connected to another node, it's a handle returned by GetClientsByFilter when
+// a ClusterRegistry is set
+// The messages sent to it are routed to its node, it can't be disconnected from this node
+func (c *Client) IsRemote() bool {
+	return c.remote != nil
+}
+
+// GetNodeID -> the node of the remote client, it's empty for the local clients
+func (c *Client) GetNodeID() string {
+	if c.remote == nil {
+		return ""
+	}
+	return c.remote.NodeID
+}
+
+// sortClusterClients -> by node and connection ID
+func sortClusterClients(clients []ClusterClient) {
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].NodeID != clients[j].NodeID {
+			return clients[i].NodeID < clients[j].NodeID
+		}
+		return clients[i].ConnectionID < clients[j].ConnectionID
+	})
+}
+
+//-------------------------------------\\
+
+// ClientsRegistry -> the registry which answers for the clients of the cluster
+// The local clients are always kept in memory (with their indexes), the registry is notified only about the
+// long-lived ones (SSE, websocket, hijacked), in the background
+// GetClientsByFilter, GetClientsByUserID, SendTo and Broadcast are answered by the registry
+// The default one (memory) knows only about the local clients, see ClusterRegistry for the distributed one
+type ClientsRegistry interface {
+	// Register -> the local client has been registered or updated (auth details, rooms)
+	Register(client *Client) error
+	// Unregister -> the local client has been unregistered
+	Unregister(client *Client) error
+	// GetClientsByFilter -> the clients matching the filter, the ones of the other nodes are handles
+	// (see Client.IsRemote)
+	GetClientsByFilter(filter FindClientsFilter) map[uint64]*Client
+	// Find -> the descriptions of the clients matching the filter
+	Find(filter FindClientsFilter) []ClusterClient
+	// Send -> queues the websocket message on the node of the client
+	Send(client ClusterClient, message []byte) error
+	// Broadcast -> sends the SSE event to the other nodes, the local clients have already received it
+	Broadcast(filter FindClientsFilter, event SSEEvent) error
+	// Close -> the node leaves the cluster
+	Close() error
+}
+
+// memoryRegistry -> the default registry, it contains only the local clients
+type memoryRegistry struct {
+	server *Server
+}
+
+// NewMemoryRegistry -> the registry of the local clients, it's the default one
+func NewMemoryRegistry(s *Server) ClientsRegistry {
+	return &memoryRegistry{server: s}
+}
+
+func (r *memoryRegistry) Register(client *Client) error {
+	return nil
+}
+
+func (r *memoryRegistry) Unregister(client *Client) error {
+	return nil
+}
+
+func (r *memoryRegistry) GetClientsByFilter(filter FindClientsFilter) map[uint64]*Client {
+	return r.server.c.getClientsByFilter(filter)
+}
+
+func (r *memoryRegistry) Find(filter FindClientsFilter) []ClusterClient {
+	return findLocalClusterClients(r.server, "", filter)
+}
+
+func (r *memoryRegistry) Send(client ClusterClient, message []byte) error {
+	return sendLocal(r.server, client.ConnectionID, message)
+}
+
+func (r *memoryRegistry) Broadcast(filter FindClientsFilter, event SSEEvent) error {
+	return nil
+}
+
+func (r *memoryRegistry) Close() error {
+	return nil
+}
+
+// findLocalClusterClients -> the local clients matching the filter
+func findLocalClusterClients(s *Server, nodeID string, filter FindClientsFilter) []ClusterClient {
+	return describeClusterClients(nodeID, s.c.getClientsByFilter(filter))
+}
+
+// describeClusterClients -> the descriptions of the local clients and of the remote handles
+func describeClusterClients(nodeID string, found map[uint64]*Client) []ClusterClient {
+	clients := make([]ClusterClient, 0, len(found))
+	for _, client := range found {
+		if client.remote != nil {
+			clients = append(clients, *client.remote)
+			continue
+		}
+		clients = append(clients, newClusterClient(nodeID, client))
+	}
+	sortClusterClients(clients)
+	return clients
+}
+
+// sendLocal -> queues the message for the local websocket client
+func sendLocal(s *Server, connectionID uint64, message []byte) error {
+	client := s.c.GetClientByID(connectionID)
+	if client == nil {
+		return define.Err(0, "client not found", connectionID)
+	}
+	return client.Send(message)
+}
+
+//-------------------------------------\\
+
+// SetClientsRegistry -> replaces the registry (ex: with a ClusterRegistry), the previous one is not closed
+// The events which are still queued and the long-lived clients are published to the new registry
+func (s *Server) SetClientsRegistry(registry ClientsRegistry) *Server {
+	if registry == nil {
+		registry = NewMemoryRegistry(s)
+	}
+	s.registryLock.Lock()
+	s.registry = registry
+	s.registryLock.Unlock()
+	s.registryRepublish()
+	return s
+}
+
+// GetClientsRegistry -> the registry of the clients
+func (s *Server) GetClientsRegistry() ClientsRegistry {
+	s.registryLock.RLock()
+	defer s.registryLock.RUnlock()
+	return s.registry
+}
+
+// registryRegister -> queues the notification about the local client (registered or updated)
+// Only the long-lived clients are published, the plain requests finish too fast for being found on another node
+func (s *Server) registryRegister(client *Client) {
+	if !client.IsLongLived() {
+		return
+	}
+	if !s.registryQueue.push(registryEvent{client: client}) {
+		client.LWarnF("registryRegister").Msg("registry queue is full, the client update has been dropped")
+	}
+}
+
+func (s *Server) registryUnregister(client *Client) {
+	if !client.IsLongLived() {
+		return
+	}
+	s.registryQueue.push(registryEvent{client: client, unregister: true})
+}
+
+// registryRepublish -> queues the long-lived clients again (ex: a node has joined the cluster)
+// They're queued after their previous events, the clients which finish meanwhile are not published
+func (s *Server) registryRepublish() {
+	for client := range s.GetClients() {
+		s.registryRegister(client)
+	}
+}
+
+// GetClusterClientsByFilter -> the descriptions of the clients found by GetClientsByFilter, with their nodes
+func (s *Server) GetClusterClientsByFilter(filter FindClientsFilter) []ClusterClient {
+	return s.GetClientsRegistry().Find(filter)
+}
+
+// GetClusterClientsByUserID -> the descriptions of the clients of the user, from all the nodes
+func (s *Server) GetClusterClientsByUserID(userID string) []ClusterClient {
+	return s.GetClusterClientsByFilter(FindClientsFilter{Users: []string{userID}})
+}
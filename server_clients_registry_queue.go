@@ -0,0 +1,97 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/kyaxcorp/go-helper/sync/_uint64"
+)
+
+// registryEvent -> a long-lived client has been registered/updated or unregistered
+type registryEvent struct {
+	client     *Client
+	unregister bool
+	// flushed -> it's closed when the previous events have been published
+	flushed chan struct{}
+}
+
+// registryQueue -> the events are published by a single goroutine, in their order
+// In this way the requests don't wait for the registry (ex: the transport of a ClusterRegistry)
+type registryQueue struct {
+	events    chan registryEvent
+	startOnce sync.Once
+	publish   func(event registryEvent)
+	// nrOfDropped -> the updates which have been dropped because the queue was full
+	nrOfDropped *_uint64.Uint64
+}
+
+func newRegistryQueue(size int, publish func(event registryEvent)) *registryQueue {
+	return &registryQueue{
+		events:      make(chan registryEvent, size),
+		publish:     publish,
+		nrOfDropped: _uint64.New(),
+	}
+}
+
+// push -> the goroutine is started by the first event
+// If the queue is full, the registers/updates are dropped, but the unregisters wait for a free place,
+// otherwise the registry would keep the disconnected clients
+func (q *registryQueue) push(event registryEvent) bool {
+	q.startOnce.Do(func() {
+		go q.run()
+	})
+	if event.unregister || event.flushed != nil {
+		q.events <- event
+		return true
+	}
+	select {
+	case q.events <- event:
+		return true
+	default:
+		q.nrOfDropped.Inc(1)
+		return false
+	}
+}
+
+// flush -> waits until the events which have been pushed before are published
+func (q *registryQueue) flush() {
+	flushed := make(chan struct{})
+	q.push(registryEvent{flushed: flushed})
+	<-flushed
+}
+
+func (q *registryQueue) run() {
+	for event := range q.events {
+		if event.flushed != nil {
+			close(event.flushed)
+			continue
+		}
+		q.publish(event)
+	}
+}
+
+//-------------------------------------\\
+
+// publishRegistryEvent -> it's called by the goroutine of the queue
+func (s *Server) publishRegistryEvent(event registryEvent) {
+	client := event.client
+	registry := s.GetClientsRegistry()
+	if event.unregister {
+		if _err := registry.Unregister(client); _err != nil {
+			client.LWarnF("registryUnregister").Err(_err).Msg("failed to unregister the client from the registry")
+		}
+		return
+	}
+	// It has finished meanwhile, its unregister has been queued after this event (or it's already published)
+	if client.isClosed.Get() {
+		return
+	}
+	if _err := registry.Register(client); _err != nil {
+		client.LWarnF("registryRegister").Err(_err).Msg("failed to register the client in the registry")
+	}
+}
+
+// GetNrOfDroppedRegistryEvents -> the client updates which haven't been published because the registry
+// queue was full
+func (s *Server) GetNrOfDroppedRegistryEvents() uint64 {
+	return s.registryQueue.nrOfDropped.Get()
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordingRegistry -> records the notifications, Register signals registering and blocks until unblock is closed
+type recordingRegistry struct {
+	memoryRegistry
+	registering chan struct{}
+	unblock     chan struct{}
+
+	lock   sync.Mutex
+	events []string
+}
+
+func (r *recordingRegistry) record(event string) {
+	r.lock.Lock()
+	r.events = append(r.events, event)
+	r.lock.Unlock()
+}
+
+func (r *recordingRegistry) getEvents() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string{}, r.events...)
+}
+
+func (r *recordingRegistry) Register(client *Client) error {
+	select {
+	case r.registering <- struct{}{}:
+	default:
+	}
+	<-r.unblock
+	r.record("register " + client.GetRequestPath())
+	return nil
+}
+
+func (r *recordingRegistry) Unregister(client *Client) error {
+	r.record("unregister " + client.GetRequestPath())
+	return nil
+}
+
+// TestRegistryNotifiesLongLivedClients -> the plain requests are not published, the streaming clients are
+// published in the background, the requests don't wait for the registry
+func TestRegistryNotifiesLongLivedClients(t *testing.T) {
+	s := newTestServer(t)
+	registry := &recordingRegistry{
+		memoryRegistry: memoryRegistry{server: s},
+		registering:    make(chan struct{}, 1),
+		unblock:        make(chan struct{}),
+	}
+	s.SetClientsRegistry(registry)
+
+	streaming := make(chan struct{})
+	release := make(chan struct{})
+	s.HttpServer.GET("/plain", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	s.HttpServer.GET("/stream", func(c *gin.Context) {
+		client := GetClientFromCtx(c)
+		client.startSending(sendKindSSE, 1)
+		defer client.stopSending()
+		close(streaming)
+		<-release
+	})
+	serve := func(path string) int {
+		response := httptest.NewRecorder()
+		s.HttpServer.ServeHTTP(response, httptest.NewRequest(http.MethodGet, path, nil))
+		return response.Code
+	}
+
+	if code := serve("/plain"); code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		serve("/stream")
+	}()
+	<-streaming
+	// The stream has been published, the registry is blocked while registering it
+	<-registry.registering
+	close(release)
+	// The request shouldn't wait for the registry
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request is waiting for the registry")
+	}
+
+	close(registry.unblock)
+	s.registryQueue.flush()
+	events := registry.getEvents()
+	if len(events) != 2 || events[0] != "register /stream" || events[1] != "unregister /stream" {
+		t.Errorf("expected the register and the unregister of the stream, got %v", events)
+	}
+}
+
+// TestRegistryQueueOrder -> the events are published in order, the full queue drops only the updates
+func TestRegistryQueueOrder(t *testing.T) {
+	var published []string
+	publishing := make(chan struct{}, 1)
+	unblock := make(chan struct{})
+	queue := newRegistryQueue(2, func(event registryEvent) {
+		select {
+		case publishing <- struct{}{}:
+		default:
+		}
+		<-unblock
+		if event.unregister {
+			published = append(published, "unregister")
+		} else {
+			published = append(published, "register")
+		}
+	})
+
+	client := newIndexedClient(1)
+	// The first one is taken by the goroutine, the next 2 fill the queue
+	queue.push(registryEvent{client: client})
+	<-publishing
+	for i := 0; i < 2; i++ {
+		if !queue.push(registryEvent{client: client}) {
+			t.Fatalf("event %d has been dropped", i)
+		}
+	}
+	if queue.push(registryEvent{client: client}) {
+		t.Error("the update should be dropped when the queue is full")
+	}
+	if queue.nrOfDropped.Get() != 1 {
+		t.Errorf("expected 1 dropped update, got %d", queue.nrOfDropped.Get())
+	}
+
+	unregistered := make(chan struct{})
+	go func() {
+		defer close(unregistered)
+		queue.push(registryEvent{client: client, unregister: true})
+	}()
+	// The unregister waits for a free place instead of being dropped
+	close(unblock)
+	<-unregistered
+	queue.flush()
+	expected := []string{"register", "register", "register", "unregister"}
+	if len(published) != len(expected) || published[3] != "unregister" {
+		t.Errorf("expected %v, got %v", expected, published)
+	}
+}
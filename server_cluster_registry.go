@@ -0,0 +1,230 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/kyaxcorp/go-helper/errors2/define"
+)
+
+type ClusterEventType string
+
+const (
+	// ClusterEventHello -> a node has joined, the others publish their clients
+	ClusterEventHello ClusterEventType = "hello"
+	// ClusterEventBye -> a node has left, its clients are removed
+	ClusterEventBye        ClusterEventType = "bye"
+	ClusterEventRegister   ClusterEventType = "register"
+	ClusterEventUnregister ClusterEventType = "unregister"
+	// ClusterEventSend -> a websocket message for a client of the target node
+	ClusterEventSend ClusterEventType = "send"
+	// ClusterEventBroadcast -> an SSE event for the matching clients of all the nodes
+	ClusterEventBroadcast ClusterEventType = "broadcast"
+)
+
+// ClusterEvent -> what the nodes publish through the transport
+type ClusterEvent struct {
+	Type ClusterEventType `json:"type"`
+	// NodeID -> the node which has published the event
+	NodeID       string             `json:"node_id"`
+	TargetNodeID string             `json:"target_node_id,omitempty"`
+	Client       *ClusterClient     `json:"client,omitempty"`
+	Message      []byte             `json:"message,omitempty"`
+	Filter       *FindClientsFilter `json:"filter,omitempty"`
+	SSEEvent     *SSEEvent          `json:"sse_event,omitempty"`
+}
+
+// ClusterTransport -> delivers the events between the nodes (see InProcessClusterHub and TCPClusterHub)
+// The events of a node should be delivered in the order they have been published
+type ClusterTransport interface {
+	// Publish -> sends the event to the other nodes
+	Publish(event ClusterEvent) error
+	// Subscribe -> the handler is called for the events published by the other nodes
+	Subscribe(handler func(event ClusterEvent))
+	Close() error
+}
+
+// ClusterRegistry -> the distributed registry, the nodes publish their register/unregister events and
+// keep the clients of the other nodes as handles, with their own indexes
+// The sends are routed to the node of the client
+type ClusterRegistry struct {
+	server    *Server
+	nodeID    string
+	transport ClusterTransport
+
+	lock sync.Mutex
+	// remote -> the handles of the clients of the other nodes, by node and connection ID (on their node)
+	remote map[string]map[uint64]*Client
+	// remoteClients -> the same handles, indexed by their connection ID's on this node
+	remoteClients *clientsData
+}
+
+// NewClusterRegistry -> joins the cluster, the other nodes publish their clients
+// Set it with Server.SetClientsRegistry, the local clients are published then
+func NewClusterRegistry(s *Server, nodeID string, transport ClusterTransport) (*ClusterRegistry, error) {
+	if nodeID == "" {
+		return nil, define.Err(0, "cluster node id is empty")
+	}
+	if transport == nil {
+		return nil, define.Err(0, "cluster transport is nil", nodeID)
+	}
+	r := &ClusterRegistry{
+		server:        s,
+		nodeID:        nodeID,
+		transport:     transport,
+		remote:        make(map[string]map[uint64]*Client),
+		remoteClients: NewClientsInstance(),
+	}
+	transport.Subscribe(r.handle)
+	if _err := r.publish(ClusterEvent{Type: ClusterEventHello}); _err != nil {
+		return nil, _err
+	}
+	return r, nil
+}
+
+// GetNodeID -> the ID of this node
+func (r *ClusterRegistry) GetNodeID() string {
+	return r.nodeID
+}
+
+func (r *ClusterRegistry) publish(event ClusterEvent) error {
+	event.NodeID = r.nodeID
+	return r.transport.Publish(event)
+}
+
+// handle -> applies the events of the other nodes
+func (r *ClusterRegistry) handle(event ClusterEvent) {
+	if event.NodeID == r.nodeID {
+		return
+	}
+	switch event.Type {
+	case ClusterEventHello:
+		// Through the registry queue, after the events which are already queued
+		r.server.registryRepublish()
+	case ClusterEventBye:
+		r.removeNode(event.NodeID)
+	case ClusterEventRegister:
+		if event.Client == nil {
+			return
+		}
+		client := *event.Client
+		client.NodeID = event.NodeID
+		// It's a remote client, even if the event hasn't been encoded (in process)
+		client.client = nil
+		r.setRemote(client)
+	case ClusterEventUnregister:
+		if event.Client == nil {
+			return
+		}
+		r.removeRemote(event.NodeID, event.Client.ConnectionID)
+	case ClusterEventSend:
+		if event.TargetNodeID != r.nodeID || event.Client == nil {
+			return
+		}
+		if _err := sendLocal(r.server, event.Client.ConnectionID, event.Message); _err != nil {
+			r.server.LWarnF("ClusterRegistry.handle").Err(_err).Msg("failed to deliver the routed message")
+		}
+	case ClusterEventBroadcast:
+		if event.Filter == nil || event.SSEEvent == nil {
+			return
+		}
+		r.server.broadcastLocal(*event.Filter, *event.SSEEvent)
+	}
+}
+
+// setRemote -> registers or updates the handle, an updated client keeps its connection ID on this node
+func (r *ClusterRegistry) setRemote(client ClusterClient) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	clients, ok := r.remote[client.NodeID]
+	if !ok {
+		clients = make(map[uint64]*Client)
+		r.remote[client.NodeID] = clients
+	}
+	connectionID := uint64(0)
+	if previous, ok := clients[client.ConnectionID]; ok {
+		connectionID = previous.connectionID
+		r.remoteClients.unregisterClient(previous)
+	}
+	handle := newRemoteClient(r.server, client, connectionID)
+	clients[client.ConnectionID] = handle
+	r.remoteClients.registerClient(handle)
+}
+
+func (r *ClusterRegistry) removeRemote(nodeID string, connectionID uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	clients, ok := r.remote[nodeID]
+	if !ok {
+		return
+	}
+	if handle, ok := clients[connectionID]; ok {
+		delete(clients, connectionID)
+		r.remoteClients.unregisterClient(handle)
+	}
+	if len(clients) == 0 {
+		delete(r.remote, nodeID)
+	}
+}
+
+// removeNode -> the node has left, all its clients are removed
+func (r *ClusterRegistry) removeNode(nodeID string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, handle := range r.remote[nodeID] {
+		r.remoteClients.unregisterClient(handle)
+	}
+	delete(r.remote, nodeID)
+}
+
+func (r *ClusterRegistry) Register(client *Client) error {
+	clusterClient := newClusterClient(r.nodeID, client)
+	return r.publish(ClusterEvent{Type: ClusterEventRegister, Client: &clusterClient})
+}
+
+func (r *ClusterRegistry) Unregister(client *Client) error {
+	return r.publish(ClusterEvent{
+		Type:   ClusterEventUnregister,
+		Client: &ClusterClient{NodeID: r.nodeID, ConnectionID: client.connectionID},
+	})
+}
+
+// GetClientsByFilter -> the local clients and the handles of the remote ones, both are searched through
+// the indexes
+func (r *ClusterRegistry) GetClientsByFilter(filter FindClientsFilter) map[uint64]*Client {
+	clients := r.server.c.getClientsByFilter(filter)
+	copyClientsInto(clients, r.remoteClients.getClientsByFilter(filter))
+	return clients
+}
+
+func (r *ClusterRegistry) Find(filter FindClientsFilter) []ClusterClient {
+	return describeClusterClients(r.nodeID, r.GetClientsByFilter(filter))
+}
+
+// Send -> the message is queued locally or routed to the node of the client
+func (r *ClusterRegistry) Send(client ClusterClient, message []byte) error {
+	if client.NodeID == r.nodeID {
+		return sendLocal(r.server, client.ConnectionID, message)
+	}
+	return r.publish(ClusterEvent{
+		Type:         ClusterEventSend,
+		TargetNodeID: client.NodeID,
+		Client:       &ClusterClient{NodeID: client.NodeID, ConnectionID: client.ConnectionID},
+		Message:      message,
+	})
+}
+
+// Broadcast -> the other nodes send the event to their matching clients
+func (r *ClusterRegistry) Broadcast(filter FindClientsFilter, event SSEEvent) error {
+	return r.publish(ClusterEvent{Type: ClusterEventBroadcast, Filter: &filter, SSEEvent: &event})
+}
+
+// GetNrOfRemoteClients -> the nr. of clients connected to the other nodes
+func (r *ClusterRegistry) GetNrOfRemoteClients() int {
+	return int(r.remoteClients.GetNrOfClients())
+}
+
+// Close -> leaves the cluster and closes the transport
+func (r *ClusterRegistry) Close() error {
+	_ = r.publish(ClusterEvent{Type: ClusterEventBye})
+	return r.transport.Close()
+}
@@ -0,0 +1,288 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/kyaxcorp/go-http/middlewares/authentication"
+)
+
+// clusterNode -> a server with a ClusterRegistry, its clients are authenticated by the "user" query param
+type clusterNode struct {
+	server   *Server
+	registry *ClusterRegistry
+	http     *httptest.Server
+}
+
+func newClusterNode(t *testing.T, nodeID string, transport ClusterTransport) *clusterNode {
+	t.Helper()
+	s := newTestServer(t)
+	authenticate := func(c *gin.Context) {
+		details := &authentication.AuthDetails{UserDetails: authentication.UserDetails{UserID: c.Query("user")}}
+		s.setClientAuthDetails(GetClientFromCtx(c), details)
+	}
+	s.WebSocket("/ws", authenticate)
+	s.SSE("/events", authenticate)
+
+	registry, _err := NewClusterRegistry(s, nodeID, transport)
+	if _err != nil {
+		t.Fatal(_err)
+	}
+	s.SetClientsRegistry(registry)
+	return &clusterNode{server: s, registry: registry, http: httptest.NewServer(s.HttpServer)}
+}
+
+func (n *clusterNode) dialWebSocket(t *testing.T, userID string) *websocket.Conn {
+	t.Helper()
+	conn, _, _err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(n.http.URL, "http")+"/ws?user="+userID, nil)
+	if _err != nil {
+		t.Fatal(_err)
+	}
+	return conn
+}
+
+// close -> the handlers should finish before the next test
+func (n *clusterNode) close(t *testing.T) {
+	n.http.CloseClientConnections()
+	waitFor(t, func() bool {
+		return n.server.GetNrOfClients() == 0
+	})
+	n.http.Close()
+	n.server.registryQueue.flush()
+}
+
+// testClusterRegistry -> two nodes connected through the transports
+func testClusterRegistry(t *testing.T, newTransport func() ClusterTransport) {
+	a := newClusterNode(t, "a", newTransport())
+	defer a.close(t)
+	// The clients connected before the second node has joined are published on its Hello
+	alice := a.dialWebSocket(t, "alice")
+	defer alice.Close()
+	waitFor(t, func() bool {
+		return len(a.server.GetClientsByUserID("alice")) == 1
+	})
+
+	b := newClusterNode(t, "b", newTransport())
+	defer b.close(t)
+	waitFor(t, func() bool {
+		return len(b.server.GetClientsByUserID("alice")) == 1
+	})
+
+	// Find, the remote clients are handles with their own connection ID's
+	var aliceLocal *Client
+	for _, client := range a.server.GetClientsByUserID("alice") {
+		aliceLocal = client
+	}
+	for connectionID, client := range b.server.GetClientsByUserID("alice") {
+		if !client.IsRemote() || client.GetNodeID() != "a" || client.GetKind() != ClientKindWebSocket {
+			t.Errorf("expected a remote websocket client of the node a, got %q %q", client.GetNodeID(), client.GetKind())
+		}
+		if b.server.c.GetClientByID(connectionID) != nil {
+			t.Error("the remote client should not be registered as a local client")
+		}
+		if client.Disconnect("test") == nil {
+			t.Error("the remote client should not be disconnected from another node")
+		}
+	}
+	found := b.server.GetClusterClientsByUserID("alice")
+	if len(found) != 1 || found[0].NodeID != "a" || found[0].ConnectionID != aliceLocal.GetConnectionID() || found[0].IsLocal() {
+		t.Errorf("unexpected cluster clients %+v", found)
+	}
+
+	// Send, routed to the node of the client
+	if nrOfRouted := b.server.SendTo(FindClientsFilter{Users: []string{"alice"}}, []byte("hello")); nrOfRouted != 1 {
+		t.Fatalf("expected the message to be routed to 1 client, got %d", nrOfRouted)
+	}
+	_, message, _err := alice.ReadMessage()
+	if _err != nil || string(message) != "hello" {
+		t.Fatalf("expected the routed message, got %q %v", message, _err)
+	}
+
+	// Register from the second node
+	bob := b.dialWebSocket(t, "bob")
+	defer bob.Close()
+	waitFor(t, func() bool {
+		return a.registry.GetNrOfRemoteClients() == 1
+	})
+	if clients := a.server.GetClientsByFilter(FindClientsFilter{All: true}); len(clients) != 2 {
+		t.Errorf("expected 2 clients in the cluster, got %d", len(clients))
+	}
+
+	// Broadcast, received by the SSE clients of the other node
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, a.http.URL+"/events?user=carol", nil)
+	response, _err := http.DefaultClient.Do(request)
+	if _err != nil {
+		t.Fatal(_err)
+	}
+	defer response.Body.Close()
+	waitFor(t, func() bool {
+		return len(b.server.GetClientsByUserID("carol")) == 1
+	})
+	b.server.Broadcast(FindClientsFilter{Users: []string{"carol"}}, SSEEvent{Data: "news"})
+	reader := bufio.NewReader(response.Body)
+	for {
+		line, _err := reader.ReadString('\n')
+		if _err != nil {
+			t.Fatal(_err)
+		}
+		if line == "data: news\n" {
+			break
+		}
+	}
+
+	// Unregister
+	cancel()
+	waitFor(t, func() bool {
+		return len(b.server.GetClientsByUserID("carol")) == 0
+	})
+
+	// Bye, the clients of the node are removed
+	if _err = b.registry.Close(); _err != nil {
+		t.Fatal(_err)
+	}
+	waitFor(t, func() bool {
+		return a.registry.GetNrOfRemoteClients() == 0
+	})
+	if clients := a.server.GetClientsByUserID("bob"); len(clients) != 0 {
+		t.Errorf("the clients of the node which has left should be removed, got %d", len(clients))
+	}
+	_ = a.registry.Close()
+}
+
+func TestClusterRegistryInProcess(t *testing.T) {
+	hub := NewInProcessClusterHub()
+	testClusterRegistry(t, hub.NewTransport)
+}
+
+func listenTCPClusterHub(t *testing.T) *TCPClusterHub {
+	t.Helper()
+	hub, _err := ListenTCPClusterHub("127.0.0.1:0")
+	if _err != nil {
+		t.Fatal(_err)
+	}
+	return hub
+}
+
+func dialTCPClusterTransport(t *testing.T, hub *TCPClusterHub) ClusterTransport {
+	t.Helper()
+	transport, _err := DialTCPClusterTransport(hub.Addr())
+	if _err != nil {
+		t.Fatal(_err)
+	}
+	return transport
+}
+
+func TestClusterRegistryTCP(t *testing.T) {
+	hub := listenTCPClusterHub(t)
+	defer hub.Close()
+	testClusterRegistry(t, func() ClusterTransport {
+		return dialTCPClusterTransport(t, hub)
+	})
+}
+
+// TestTCPClusterHubByeOnDrop -> the node whose connection drops is removed from the others
+func TestTCPClusterHubByeOnDrop(t *testing.T) {
+	hub := listenTCPClusterHub(t)
+	defer hub.Close()
+
+	a := newClusterNode(t, "a", dialTCPClusterTransport(t, hub))
+	defer a.close(t)
+	bTransport := dialTCPClusterTransport(t, hub)
+	b := newClusterNode(t, "b", bTransport)
+	defer b.close(t)
+
+	bob := b.dialWebSocket(t, "bob")
+	defer bob.Close()
+	waitFor(t, func() bool {
+		return a.registry.GetNrOfRemoteClients() == 1
+	})
+
+	// Without the Bye of the node
+	_ = bTransport.Close()
+	waitFor(t, func() bool {
+		return a.registry.GetNrOfRemoteClients() == 0
+	})
+	_ = a.registry.Close()
+}
+
+// blockingTransport -> records the published register/unregister events, they're blocked until unblock is closed
+type blockingTransport struct {
+	publishing chan struct{}
+	unblock    chan struct{}
+
+	lock      sync.Mutex
+	published []ClusterEventType
+}
+
+func (t *blockingTransport) Publish(event ClusterEvent) error {
+	if event.Type != ClusterEventRegister && event.Type != ClusterEventUnregister {
+		return nil
+	}
+	select {
+	case t.publishing <- struct{}{}:
+	default:
+	}
+	<-t.unblock
+	t.lock.Lock()
+	t.published = append(t.published, event.Type)
+	t.lock.Unlock()
+	return nil
+}
+
+func (t *blockingTransport) Subscribe(handler func(event ClusterEvent)) {}
+
+func (t *blockingTransport) Close() error {
+	return nil
+}
+
+// TestClusterHelloThroughTheQueue -> the clients are published again on Hello after their queued events,
+// the ones which have finished meanwhile are not published
+func TestClusterHelloThroughTheQueue(t *testing.T) {
+	s := newTestServer(t)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	client := s.newClient(ctx)
+	client.kind = ClientKindWebSocket
+	s.c.registerClient(client)
+
+	transport := &blockingTransport{publishing: make(chan struct{}, 1), unblock: make(chan struct{})}
+	registry, _err := NewClusterRegistry(s, "a", transport)
+	if _err != nil {
+		t.Fatal(_err)
+	}
+	// The queue is blocked while publishing the client
+	s.SetClientsRegistry(registry)
+	<-transport.publishing
+
+	handled := make(chan struct{})
+	go func() {
+		defer close(handled)
+		registry.handle(ClusterEvent{Type: ClusterEventHello, NodeID: "b"})
+	}()
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Hello is waiting for the transport, it should be queued")
+	}
+
+	client.setAsClosed()
+	s.c.unregisterClient(client)
+	s.registryUnregister(client)
+	close(transport.unblock)
+	s.registryQueue.flush()
+
+	transport.lock.Lock()
+	defer transport.lock.Unlock()
+	if len(transport.published) != 2 || transport.published[1] != ClusterEventUnregister {
+		t.Errorf("expected the register and the unregister of the client, got %v", transport.published)
+	}
+}
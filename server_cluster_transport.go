@@ -0,0 +1,253 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"sync"
+
+	"github.com/kyaxcorp/go-helper/errors2/define"
+)
+
+// InProcessClusterHub -> connects the nodes running in the same process (ex: tests)
+// The events are delivered synchronously, in the order they have been published
+type InProcessClusterHub struct {
+	lock       sync.RWMutex
+	transports map[*inProcessTransport]bool
+}
+
+func NewInProcessClusterHub() *InProcessClusterHub {
+	return &InProcessClusterHub{
+		transports: make(map[*inProcessTransport]bool),
+	}
+}
+
+// NewTransport -> the transport of a node
+func (h *InProcessClusterHub) NewTransport() ClusterTransport {
+	t := &inProcessTransport{hub: h}
+	h.lock.Lock()
+	h.transports[t] = true
+	h.lock.Unlock()
+	return t
+}
+
+type inProcessTransport struct {
+	hub         *InProcessClusterHub
+	handler     func(event ClusterEvent)
+	handlerLock sync.RWMutex
+}
+
+func (t *inProcessTransport) Publish(event ClusterEvent) error {
+	t.hub.lock.RLock()
+	if !t.hub.transports[t] {
+		t.hub.lock.RUnlock()
+		return define.Err(0, "cluster transport is closed")
+	}
+	others := make([]*inProcessTransport, 0, len(t.hub.transports))
+	for other := range t.hub.transports {
+		if other != t {
+			others = append(others, other)
+		}
+	}
+	t.hub.lock.RUnlock()
+
+	for _, other := range others {
+		other.handlerLock.RLock()
+		handler := other.handler
+		other.handlerLock.RUnlock()
+		if handler != nil {
+			handler(event)
+		}
+	}
+	return nil
+}
+
+func (t *inProcessTransport) Subscribe(handler func(event ClusterEvent)) {
+	t.handlerLock.Lock()
+	t.handler = handler
+	t.handlerLock.Unlock()
+}
+
+func (t *inProcessTransport) Close() error {
+	t.hub.lock.Lock()
+	delete(t.hub.transports, t)
+	t.hub.lock.Unlock()
+	return nil
+}
+
+//-------------------------------------\\
+
+// TCPClusterHub -> relays the events between the nodes connected by DialTCPClusterTransport
+// The events are json lines, it's meant for tests (loopback) and small setups
+type TCPClusterHub struct {
+	listener net.Listener
+	lock     sync.Mutex
+	conns    map[net.Conn]*sync.Mutex
+	wg       sync.WaitGroup
+}
+
+// ListenTCPClusterHub -> starts relaying, use "127.0.0.1:0" for a random port (see Addr)
+func ListenTCPClusterHub(address string) (*TCPClusterHub, error) {
+	listener, _err := net.Listen("tcp", address)
+	if _err != nil {
+		return nil, define.Err(0, "failed to listen for the cluster hub", address, _err.Error())
+	}
+	h := &TCPClusterHub{
+		listener: listener,
+		conns:    make(map[net.Conn]*sync.Mutex),
+	}
+	h.wg.Add(1)
+	go h.accept()
+	return h, nil
+}
+
+// Addr -> the address on which the hub is listening
+func (h *TCPClusterHub) Addr() string {
+	return h.listener.Addr().String()
+}
+
+func (h *TCPClusterHub) accept() {
+	defer h.wg.Done()
+	for {
+		conn, _err := h.listener.Accept()
+		if _err != nil {
+			return
+		}
+		h.lock.Lock()
+		h.conns[conn] = &sync.Mutex{}
+		h.lock.Unlock()
+		h.wg.Add(1)
+		go h.relay(conn)
+	}
+}
+
+// relay -> writes the events of the node to all the other nodes
+// When the connection drops without a Bye, the hub sends it on behalf of the node
+func (h *TCPClusterHub) relay(conn net.Conn) {
+	defer h.wg.Done()
+	// nodeID -> it's taken from the events of the node
+	nodeID := ""
+	leaving := false
+	defer func() {
+		h.lock.Lock()
+		delete(h.conns, conn)
+		h.lock.Unlock()
+		_ = conn.Close()
+		if nodeID != "" && !leaving {
+			bye, _ := json.Marshal(ClusterEvent{Type: ClusterEventBye, NodeID: nodeID})
+			h.forward(conn, append(bye, '\n'))
+		}
+	}()
+
+	decoder := json.NewDecoder(bufio.NewReader(conn))
+	for {
+		var event json.RawMessage
+		if decoder.Decode(&event) != nil {
+			return
+		}
+		var header struct {
+			Type   ClusterEventType `json:"type"`
+			NodeID string           `json:"node_id"`
+		}
+		if json.Unmarshal(event, &header) == nil && header.NodeID != "" {
+			nodeID = header.NodeID
+			leaving = header.Type == ClusterEventBye
+		}
+		h.forward(conn, append(event, '\n'))
+	}
+}
+
+// forward -> writes the line to all the nodes, except the one which has sent it
+func (h *TCPClusterHub) forward(from net.Conn, line []byte) {
+	// Not writing under the hub lock, a slow node would block the others
+	h.lock.Lock()
+	others := make(map[net.Conn]*sync.Mutex, len(h.conns))
+	for other, writeLock := range h.conns {
+		if other != from {
+			others[other] = writeLock
+		}
+	}
+	h.lock.Unlock()
+
+	for other, writeLock := range others {
+		writeLock.Lock()
+		_, _ = other.Write(line)
+		writeLock.Unlock()
+	}
+}
+
+// Close -> stops listening and disconnects the nodes
+func (h *TCPClusterHub) Close() error {
+	_err := h.listener.Close()
+	h.lock.Lock()
+	for conn := range h.conns {
+		_ = conn.Close()
+	}
+	h.lock.Unlock()
+	h.wg.Wait()
+	return _err
+}
+
+// tcpTransport -> the node side of the TCPClusterHub
+type tcpTransport struct {
+	conn        net.Conn
+	writeLock   sync.Mutex
+	handler     func(event ClusterEvent)
+	handlerLock sync.RWMutex
+	done        chan struct{}
+}
+
+// DialTCPClusterTransport -> connects the node to the TCPClusterHub
+func DialTCPClusterTransport(address string) (ClusterTransport, error) {
+	conn, _err := net.Dial("tcp", address)
+	if _err != nil {
+		return nil, define.Err(0, "failed to connect to the cluster hub", address, _err.Error())
+	}
+	t := &tcpTransport{
+		conn: conn,
+		done: make(chan struct{}),
+	}
+	go t.read()
+	return t, nil
+}
+
+// read -> the events received before Subscribe are dropped
+func (t *tcpTransport) read() {
+	defer close(t.done)
+	decoder := json.NewDecoder(bufio.NewReader(t.conn))
+	for {
+		var event ClusterEvent
+		if decoder.Decode(&event) != nil {
+			return
+		}
+		t.handlerLock.RLock()
+		handler := t.handler
+		t.handlerLock.RUnlock()
+		if handler != nil {
+			handler(event)
+		}
+	}
+}
+
+func (t *tcpTransport) Publish(event ClusterEvent) error {
+	encoded, _err := json.Marshal(event)
+	if _err != nil {
+		return _err
+	}
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+	_, _err = t.conn.Write(append(encoded, '\n'))
+	return _err
+}
+
+func (t *tcpTransport) Subscribe(handler func(event ClusterEvent)) {
+	t.handlerLock.Lock()
+	t.handler = handler
+	t.handlerLock.Unlock()
+}
+
+func (t *tcpTransport) Close() error {
+	_err := t.conn.Close()
+	<-t.done
+	return _err
+}
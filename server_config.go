@@ -0,0 +1,18 @@
+package server
+
+import (
+	"github.com/kyaxcorp/go-http/config"
+)
+
+// GetConfig -> returns the running config, it contains secrets!
+func (s *Server) GetConfig() config.Config {
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+	return s.config
+}
+
+// EffectiveConfig -> returns the config the server is running with (defaults, corrected logger path,
+// generated ssl paths, live reloads), keyed by the yaml key names and with the secrets redacted
+func (s *Server) EffectiveConfig() map[string]interface{} {
+	return config.Redact(s.GetConfig())
+}
@@ -5,18 +5,20 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gookit/color"
+	"github.com/gorilla/websocket"
 	"github.com/kyaxcorp/go-helper/certs"
-	"github.com/kyaxcorp/go-helper/conv"
 	"github.com/kyaxcorp/go-helper/errors2/define"
 	"github.com/kyaxcorp/go-helper/file"
 	"github.com/kyaxcorp/go-helper/filesystem"
 	"github.com/kyaxcorp/go-helper/sync/_bool"
 	"github.com/kyaxcorp/go-helper/sync/_map_string_interface"
+	"github.com/kyaxcorp/go-helper/sync/_string"
 	"github.com/kyaxcorp/go-helper/sync/_time"
 	"github.com/kyaxcorp/go-helper/sync/_uint64"
 	"github.com/kyaxcorp/go-http/config"
 	"github.com/kyaxcorp/go-http/middlewares/connection"
 	"github.com/kyaxcorp/go-http/middlewares/request_timing"
+	"github.com/kyaxcorp/go-http/middlewares/status_auth"
 	"github.com/kyaxcorp/go-http/routes/ping"
 	"github.com/kyaxcorp/go-logger"
 	"github.com/kyaxcorp/go-logger/appLog"
@@ -46,97 +48,47 @@ func New(
 	info().Msg("entering...")
 	defer info().Msg("leaving...")
 
-	if !conv.ParseBool(config.IsEnabled) {
+	// An invalid value is reported by the validation below
+	if config.IsEnabled.IsValid() && !config.IsEnabled.Bool() {
 		_error().Str("instance_name", config.Name).Msg("http server is disabled, check your config")
 		return nil, define.Err(0, "http server is disabled, check your config", config.Name)
 	}
 
 	info().Msg("configuring logger")
 
-	var loggerDirPath string
-	// Setting default values for logger
-	if config.Logger.Name == "" {
-		config.Logger.Name = config.Name
-	}
-	// If DirLogPath is not defined, it will set the default folder!
-	if config.Logger.DirLogPath == "" {
-		loggerDirPath = loggerPaths.GetLogsPathForServers("http/" + config.Logger.Name)
-		config.Logger.DirLogPath = loggerDirPath + filesystem.DirSeparator() + "server" + filesystem.DirSeparator()
-		_debug().Str("generated_dir_log_path", config.Logger.DirLogPath).Msg("logger DirLogPath empty, generating...")
-	} else {
-		loggerDirPath = config.Logger.DirLogPath
-		// Correct the path!
-		config.Logger.DirLogPath = file.FilterPath(loggerDirPath + filesystem.DirSeparator() + "server" + filesystem.DirSeparator())
-		_debug().Str("generated_dir_log_path", config.Logger.DirLogPath).Msg("correcting dir log path")
-	}
-
-	// Set Module Name
-	if config.Logger.ModuleName == "" {
-		config.Logger.ModuleName = "HTTP Server=" + config.Name
-	}
+	loggerDirPath := prepareLoggerConfig(&config)
 
-	if conv.ParseBool(config.EnableUnsecure) && len(config.ListeningAddresses) == 0 {
-		_error().Msg(color.Style{color.LightRed}.Render("unsecure connections are enabled but no listening addresses"))
-		return nil, define.Err(0, "no listening addresses are provided", config.Name)
+	info().Msg("validating config")
+	// All the problems are reported at once!
+	if _err := config.Validate(); _err != nil {
+		_error().Err(_err).Msg(color.Style{color.LightRed}.Render("invalid config"))
+		return nil, _err
 	}
 
-	if conv.ParseBool(config.EnableSSL) && len(config.ListeningAddressesSSL) == 0 {
-		_error().Msg(color.Style{color.LightRed}.Render("secure connections are enabled but no listening addresses"))
-		return nil, define.Err(0, "no listening ssl addresses are provided", config.Name)
-	}
+	if config.EnableSSL.Bool() && config.SSLCertFilePath == "" && config.SSLKeyFilePath == "" {
+		// Missing paths... the validation has already checked that auto generation is enabled
+		warn().Msg("params SSLCertFilePath & SSLKeyFilePath are empty, auto generating...")
 
-	if conv.ParseBool(config.EnableSSL) {
-		info().Msg("checking certificates...")
-		// if ssl enabled, check certificates
-		sslKeyFilePathEmpty := false
-		sslCertFilePathEmpty := false
-		if config.SSLKeyFilePath == "" {
-			sslKeyFilePathEmpty = true
-			warn().Msg("param SSLKeyFilePath empty...")
-		}
-		if config.SSLCertFilePath == "" {
-			sslCertFilePathEmpty = true
-			warn().Msg("param SSLCertFilePath empty...")
+		info().Msg("auto generating ssl certificates")
+		// Auto Generate
+		certsConfig := &certs.CertGeneration{
+			Host: "localhost",
 		}
 
-		// Missing paths...
-		if sslKeyFilePathEmpty && sslCertFilePathEmpty {
-			warn().Msg("params SSLCertFilePath & SSLKeyFilePath are empty, checking auto generation...")
-
-			// Auto Generating certificates
-			if conv.ParseBool(config.SSLAutoGenerateCerts) {
-				info().Msg("auto generating ssl certificates")
-				// Auto Generate
-				certsConfig := &certs.CertGeneration{
-					Host: "localhost",
-				}
-
-				certificatesInstanceName := "http_" + config.Name
-				info().Str("certs_instance_name", certificatesInstanceName).Msg("generating instance name")
-				// TODO: should we filter the naming... it's important filtration for files!
-				_err := certs.GenerateCerts(certificatesInstanceName, certsConfig)
-				if _err != nil {
-					return nil, define.Err(0, "failed to generate http certificates", _err.Error(), config.Name)
-				}
-				info().Msg(color.Style{color.LightGreen}.Render("certificates generated successfully"))
-
-				config.SSLKeyFilePath = certsConfig.KeyPath
-				config.SSLCertFilePath = certsConfig.CertPath
-			}
-		} else {
-			// Error?!
-			return nil, define.Err(0, "http ssl key file or certificate is empty", config.Name)
+		certificatesInstanceName := "http_" + config.Name
+		info().Str("certs_instance_name", certificatesInstanceName).Msg("generating instance name")
+		// TODO: should we filter the naming... it's important filtration for files!
+		_err := certs.GenerateCerts(certificatesInstanceName, certsConfig)
+		if _err != nil {
+			return nil, define.Err(0, "failed to generate http certificates", _err.Error(), config.Name)
 		}
+		info().Msg(color.Style{color.LightGreen}.Render("certificates generated successfully"))
+
+		config.SSLKeyFilePath = certsConfig.KeyPath
+		config.SSLCertFilePath = certsConfig.CertPath
 
 		_debug().Str("ssl_cert_file_path", config.SSLCertFilePath).Msg("ssl certificate")
 		_debug().Str("ssl_key_file_path", config.SSLKeyFilePath).Msg("ssl key")
-
-		if config.SSLCertFilePath == "" && config.SSLKeyFilePath == "" {
-			// If still empty... then let's throw an error!
-			_err := define.Err(0, "both certificate and key are empty, server will not start", config.Name)
-			_error().Err(_err).Msg("")
-			return nil, _err
-		}
 	}
 
 	// Set the default values for the config... that's in case something is missed
@@ -150,6 +102,7 @@ func New(
 	s := &Server{
 		Name:        config.Name,
 		Description: config.Description,
+		description: _string.New(),
 
 		connectionID: _uint64.New(),
 		startTime:    _time.New(),
@@ -164,11 +117,11 @@ func New(
 		Logger:        logger.New(loggerDefaultConfig),
 
 		//
-		enableSSL:   conv.ParseBool(config.EnableSSL),
+		enableSSL:   config.EnableSSL.Bool(),
 		sslCertPath: config.SSLCertFilePath,
 		sslKeyPath:  config.SSLKeyFilePath,
 		//
-		enableUnsecure: conv.ParseBool(config.EnableUnsecure),
+		enableUnsecure: config.EnableUnsecure.Bool(),
 		//
 		ListeningAddresses:    config.ListeningAddresses,
 		ListeningAddressesSSL: config.ListeningAddressesSSL,
@@ -177,6 +130,26 @@ func New(
 		onRequest:  _map_string_interface.New(),
 		onResponse: _map_string_interface.New(),
 
+		onClientDisconnected: _map_string_interface.New(),
+		onWebSocketMessage:   _map_string_interface.New(),
+
+		onUserOnline:    _map_string_interface.New(),
+		onUserOffline:   _map_string_interface.New(),
+		onDeviceOnline:  _map_string_interface.New(),
+		onDeviceOffline: _map_string_interface.New(),
+
+		onTokenExpired:           _map_string_interface.New(),
+		disconnectOnTokenExpired: _bool.NewVal(true),
+
+		wsUpgrader: &websocket.Upgrader{
+			ReadBufferSize:  DefaultWebSocketBufferSize,
+			WriteBufferSize: DefaultWebSocketBufferSize,
+		},
+
+		traffic:           newServerTraffic(),
+		disconnectHistory: newDisconnectHistory(config.DisconnectHistory.Size, config.DisconnectHistory.MaxAge, config.DisconnectHistory.Kinds),
+		sse:               newSSEHub(DefaultSSEReplayBufferSize),
+
 		// Stop
 		//onStop       map[string]OnStop
 		onStop:       _map_string_interface.New(),
@@ -190,8 +163,28 @@ func New(
 
 		HttpServer: nil,
 
+		listeners: make(map[string]*listener),
+
+		// Reload
+		onBeforeReload: _map_string_interface.New(),
+		onReloaded:     _map_string_interface.New(),
+		onReloadFailed: _map_string_interface.New(),
+
 		enableServerStatus: _bool.New(),
+
+		// The registry of the active clients
+		c: NewClientsInstance(),
 	}
+	s.description.Set(config.Description)
+	// The level is checked by the sampler, in this way it can be changed at runtime
+	s.logLevel = newLogLevelSampler(loggerDefaultConfig.Level)
+	levelLogger := s.Logger.Logger.Level(zerolog.TraceLevel).Sample(s.logLevel)
+	s.Logger.Logger = &levelLogger
+	// The presence events are dispatched to the callbacks of the server
+	s.c.presence.handler = s.onPresenceEvent
+	s.tokenExpiry = newTokenExpiryScheduler(s.tokenExpired)
+	s.registry = NewMemoryRegistry(s)
+	s.registryQueue = newRegistryQueue(DefaultRegistryQueueSize, s.publishRegistryEvent)
 
 	infoServer := func() *zerolog.Event {
 		return s.LInfoF("New HTTP Server")
@@ -228,15 +221,75 @@ func New(
 	// Latency in processing
 	s.HttpServer.Use(request_timing.GetMiddleware(s.Logger))
 
+	infoServer().Msg("setting default middleware for clients registry")
+	// Each request is registered as a Client, it uses the connection details
+	s.HttpServer.Use(s.clientsMiddleware())
+
 	// Set ping listener
 	ping.Ping(s.HttpServer)
 
-	if conv.ParseBool(config.EnableServerStatus) {
+	// The credentials are set even if the status is disabled, it can be enabled later through ApplyConfig
+	s.SetStatusCredentials(config.ServerStatusUsername, config.ServerStatusPassword)
+	s.SetStatusAccounts(statusAccountsFromConfig(config.ServerStatusAccounts))
+	// The routes are registered even if the status is disabled, it can be enabled later through ApplyConfig
+	s.registerServerStatus()
+	if config.EnableServerStatus.Bool() {
 		infoServer().Msg("enabling server status")
-		s.SetStatusCredentials(config.ServerStatusUsername, config.ServerStatusPassword)
 		s.EnableServerStatus()
 	}
 
+	s.SetSessionLimits(config.SessionLimits)
+
+	// Keeping the running config, it's the base for the live reloads
+	s.config = config
+
 	infoServer().Msg("leaving http constructor")
 	return s, nil
 }
+
+// prepareLoggerConfig -> sets the logger name, module name and the logs dir path (it's corrected or generated)
+// It returns the main folder where the logs are stored
+func prepareLoggerConfig(config *config.Config) string {
+	_debug := func() *zerolog.Event {
+		return appLog.DebugF("prepareLoggerConfig")
+	}
+
+	var loggerDirPath string
+	// Setting default values for logger
+	if config.Logger.Name == "" {
+		config.Logger.Name = config.Name
+	}
+	// If DirLogPath is not defined, it will set the default folder!
+	if config.Logger.DirLogPath == "" {
+		loggerDirPath = loggerPaths.GetLogsPathForServers("http/" + config.Logger.Name)
+		config.Logger.DirLogPath = loggerDirPath + filesystem.DirSeparator() + "server" + filesystem.DirSeparator()
+		_debug().Str("generated_dir_log_path", config.Logger.DirLogPath).Msg("logger DirLogPath empty, generating...")
+	} else {
+		loggerDirPath = config.Logger.DirLogPath
+		// Correct the path!
+		config.Logger.DirLogPath = file.FilterPath(loggerDirPath + filesystem.DirSeparator() + "server" + filesystem.DirSeparator())
+		_debug().Str("generated_dir_log_path", config.Logger.DirLogPath).Msg("correcting dir log path")
+	}
+
+	// Set Module Name
+	if config.Logger.ModuleName == "" {
+		config.Logger.ModuleName = "HTTP Server=" + config.Name
+	}
+	return loggerDirPath
+}
+
+func statusAccountsFromConfig(configAccounts []config.StatusAccount) []status_auth.Account {
+	accounts := make([]status_auth.Account, 0, len(configAccounts))
+	for _, account := range configAccounts {
+		scope := status_auth.Scope(account.Scope)
+		if scope == "" {
+			scope = status_auth.ScopeReadOnly
+		}
+		accounts = append(accounts, status_auth.Account{
+			Username: account.Username,
+			Password: account.Password,
+			Scope:    scope,
+		})
+	}
+	return accounts
+}
@@ -1,5 +1,60 @@
 package server
 
+import (
+	"net/http"
+	"time"
+)
+
 const DefaultCloseCode = 1000
 const DefaultCloseReason = "No specific reason!"
 const DefaultListeningAddress = "0.0.0.0:8080"
+
+// SSE
+const DefaultSSEHeartbeatInterval = 15 * time.Second
+
+// DefaultSSESendBufferSize -> the nr. of messages queued for a client, when it's full the client is a slow consumer
+const DefaultSSESendBufferSize = 64
+
+// DefaultSSEReplayBufferSize -> the nr. of broadcast events kept for Last-Event-ID replay
+const DefaultSSEReplayBufferSize = 256
+
+// SlowConsumerReason -> the disconnect reason of the clients which don't read their messages fast enough
+const SlowConsumerReason = "slow consumer"
+
+// Session limits
+const DefaultSessionLimitStatusCode = http.StatusTooManyRequests
+const SessionLimitRejectedReason = "session limit exceeded"
+const SessionLimitEvictedReason = "evicted by a newer session"
+
+// DefaultRegistryQueueSize -> the nr. of registry events waiting to be published, when it's full the updates
+// of the clients are dropped (the unregisters wait)
+const DefaultRegistryQueueSize = 4096
+
+// DefaultForEachClientConcurrency -> the nr. of workers used by ForEachClient when it's not set
+const DefaultForEachClientConcurrency = 16
+
+// FinishedReason -> the reason kept in the disconnect history for the clients which haven't been disconnected
+// by the server (the request has finished, or the connection has been closed by the peer)
+const FinishedReason = "finished"
+
+// TokenExpiredReason -> the disconnect reason of the clients whose auth token has expired
+const TokenExpiredReason = "auth token expired"
+
+// WebSocket
+const DefaultWebSocketBufferSize = 1024
+const DefaultWebSocketSendBufferSize = 256
+
+// DefaultWebSocketWriteWait -> the time allowed to write a message to the client
+const DefaultWebSocketWriteWait = 10 * time.Second
+
+// DefaultWebSocketPongWait -> the time allowed to read the next pong message from the client
+const DefaultWebSocketPongWait = 60 * time.Second
+
+// DefaultWebSocketPingPeriod -> the pings are sent with this period, it must be less than the pong wait
+const DefaultWebSocketPingPeriod = (DefaultWebSocketPongWait * 9) / 10
+
+// DefaultWebSocketMaxMessageSize -> the max size of a message received from the client
+const DefaultWebSocketMaxMessageSize = 512 * 1024
+
+// DefaultWebSocketResponseTimeout -> the time allowed to the client to respond to SendWithResponse
+const DefaultWebSocketResponseTimeout = 30 * time.Second
@@ -10,6 +10,11 @@ func (s *Server) GetNrOfClients() uint {
 	return s.c.GetNrOfClients()
 }
 
+// GetDescription -> the current description, it can be changed by ApplyConfig
+func (s *Server) GetDescription() string {
+	return s.description.Get()
+}
+
 func (s *Server) GetHttpServer() *gin.Engine {
 	return s.HttpServer
 }
@@ -27,3 +32,15 @@ func (s *Server) GetClientsLogPath() string {
 func (s *Server) GetClientsOrderedByConnectionID() map[int64]*Client {
 	return s.c.GetClientsOrderedByConnectionID()
 }
+
+func (s *Server) GetClientsSortedByConnectionID() []*Client {
+	return s.c.GetClientsSortedByConnectionID()
+}
+
+func (s *Server) GetClientsSorted(sortBy ClientsSort) []*Client {
+	return s.c.GetClientsSorted(sortBy)
+}
+
+func (s *Server) GetClientsPage(options ClientsPageOptions) (ClientsPage, error) {
+	return s.c.GetClientsPage(options)
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gookit/color"
+	"github.com/kyaxcorp/go-helper/errors2/define"
+	"github.com/kyaxcorp/go-helper/network/port"
+	"github.com/rs/zerolog"
+)
+
+// How much we wait for the active requests to finish when a listener is removed at runtime
+const listenerShutdownTimeout = 10 * time.Second
+
+type listener struct {
+	// address -> it's the configured address (it can contain +)
+	address string
+	// boundAddress -> it's the address on which we are really listening
+	boundAddress string
+	isSSL        bool
+	instance     *http.Server
+}
+
+func listenerKey(address string, isSSL bool) string {
+	if isSSL {
+		return "https://" + address
+	}
+	return "http://" + address
+}
+
+// createListener -> prepares the http instance for the address, it doesn't start listening!
+func (s *Server) createListener(listeningAddress string, isSSL bool) (*listener, error) {
+	info := func() *zerolog.Event {
+		return s.LInfoF("createListener")
+	}
+	warn := func() *zerolog.Event {
+		return s.LWarnF("createListener")
+	}
+	_error := func() *zerolog.Event {
+		return s.LErrorF("createListener")
+	}
+
+	configuredAddress := listeningAddress
+
+	searchFreePort := false
+	if strings.Contains(listeningAddress, "+") {
+		searchFreePort = true
+	}
+	listeningAddress = port.FilterAddress(listeningAddress)
+
+	if !searchFreePort {
+		if busy, _err := port.IsTCPBusy(listeningAddress); busy {
+			_error().
+				Err(_err).
+				Str("listening_address", listeningAddress).
+				Msg("listening address already busy")
+			return nil, define.Err(0, "listening address already busy", listeningAddress)
+		}
+	} else {
+		newListeningAddress, _err := port.SearchAndLockFreeTCPAddress(listeningAddress)
+		if _err != nil {
+			_error().
+				Err(_err).
+				Str("new_listening_address", newListeningAddress).
+				Str("listening_address", listeningAddress).
+				Msg("listening address already busy")
+			return nil, define.Err(0, "failed to find a free listening address", listeningAddress)
+		}
+		if listeningAddress != newListeningAddress {
+			warn().
+				Str("new_listening_address", newListeningAddress).
+				Str("listening_address", listeningAddress).
+				Msg("auto binding is enabled, listening address has been changed")
+		}
+
+		listeningAddress = newListeningAddress
+	}
+
+	l := &listener{
+		address:      configuredAddress,
+		boundAddress: listeningAddress,
+		isSSL:        isSSL,
+		instance: &http.Server{
+			Addr:    listeningAddress,
+			Handler: s.HttpServer,
+		},
+	}
+
+	if isSSL {
+		info().Str("listening_ssl_on", listeningAddress).Msg("creating http(s) instance")
+		// The certificate is taken on each handshake, this way it can be swapped at runtime
+		// By leaving the auto-configuration, the app already will have http/2 enabled!
+		l.instance.TLSConfig = &tls.Config{
+			GetCertificate: s.getCertificate,
+		}
+	} else {
+		info().Str("listening_on", listeningAddress).Msg("creating http instance")
+	}
+	return l, nil
+}
+
+// serveListener -> starts listening in a separate goroutine
+func (s *Server) serveListener(l *listener) {
+	_error := func() *zerolog.Event {
+		return s.LErrorF("serveListener")
+	}
+
+	if l.isSSL {
+		s.LInfoF("serveListener").Str("running_on", l.boundAddress).Msg("running http(s) server")
+		//TODO: SSL SERVER IS CPU CONSUMING!!!! even with no connections -> ONLY ON WINDOWS!!!!!
+		go func() {
+			// TODO: make a callback for fail listening!
+			_err := l.instance.ListenAndServeTLS("", "")
+			if _err != nil && _err != http.ErrServerClosed {
+				_error().Err(_err).Msg(color.Style{color.LightRed}.Render("failed to listen http SSL server"))
+			}
+		}()
+		return
+	}
+
+	s.LInfoF("serveListener").Str("running_on", l.boundAddress).Msg("running http server")
+	go func() {
+		// TODO: make a callback for fail listening!
+		_err := l.instance.ListenAndServe()
+		if _err != nil && _err != http.ErrServerClosed {
+			_error().Err(_err).Msg(color.Style{color.LightRed}.Render("failed to listen http server"))
+		}
+	}()
+}
+
+// shutdownListener -> stops accepting new connections and waits for the active ones (until ctx is done)
+func (s *Server) shutdownListener(ctx context.Context, l *listener) {
+	s.LInfoF("shutdownListener").Str("shutting_down", l.boundAddress).Msg("shutting down server")
+	_err := l.instance.Shutdown(ctx)
+	if _err != nil {
+		s.LErrorF("shutdownListener").Err(_err).Msg("failed shutting down http server")
+	}
+}
+
+// shutdownListeners -> shuts down all the running listeners
+func (s *Server) shutdownListeners(ctx context.Context) {
+	s.listenersLock.Lock()
+	listeners := s.listeners
+	s.listeners = make(map[string]*listener)
+	s.listenersLock.Unlock()
+
+	for _, l := range listeners {
+		s.shutdownListener(ctx, l)
+	}
+}
+
+func (s *Server) isListenerEnabled(isSSL bool) bool {
+	if isSSL {
+		return s.enableSSL
+	}
+	return s.enableUnsecure
+}
+
+// AddListener -> adds a new listening address, if the server is started it will also start listening on it
+func (s *Server) AddListener(address string, isSSL bool) error {
+	if address == "" {
+		return define.Err(0, "listening address is empty")
+	}
+	// Same as the config validation, the "+" char (auto searching for a free port) is accepted
+	_, portStr, _err := net.SplitHostPort(port.FilterAddress(address))
+	if _err != nil {
+		return define.Err(0, "invalid listening address", address, _err.Error())
+	}
+	if _, _err = strconv.ParseUint(portStr, 10, 16); _err != nil {
+		return define.Err(0, "invalid port in listening address", address)
+	}
+
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+
+	if isSSL && s.getCertificateSnapshot() == nil && s.isStarted.Get() {
+		return define.Err(0, "ssl certificate is not loaded", address)
+	}
+
+	addresses := &s.ListeningAddresses
+	if isSSL {
+		addresses = &s.ListeningAddressesSSL
+	}
+	for _, existing := range *addresses {
+		if existing == address {
+			return define.Err(0, "listening address already exists", address)
+		}
+	}
+
+	if s.isStarted.Get() && s.isListenerEnabled(isSSL) {
+		l, _err := s.createListener(address, isSSL)
+		if _err != nil {
+			return _err
+		}
+		s.listeners[listenerKey(address, isSSL)] = l
+		s.serveListener(l)
+	}
+
+	*addresses = append(*addresses, address)
+	return nil
+}
+
+// RemoveListener -> removes the listening address, if it's running it will be gracefully shut down
+func (s *Server) RemoveListener(address string, isSSL bool) error {
+	s.listenersLock.Lock()
+
+	addresses := &s.ListeningAddresses
+	if isSSL {
+		addresses = &s.ListeningAddressesSSL
+	}
+	found := false
+	newAddresses := make([]string, 0, len(*addresses))
+	for _, existing := range *addresses {
+		if existing == address {
+			found = true
+			continue
+		}
+		newAddresses = append(newAddresses, existing)
+	}
+	if !found {
+		s.listenersLock.Unlock()
+		return define.Err(0, "listening address not found", address)
+	}
+	*addresses = newAddresses
+
+	key := listenerKey(address, isSSL)
+	l, running := s.listeners[key]
+	delete(s.listeners, key)
+	s.listenersLock.Unlock()
+
+	if running {
+		ctx, cancel := context.WithTimeout(context.Background(), listenerShutdownTimeout)
+		defer cancel()
+		s.shutdownListener(ctx, l)
+	}
+	return nil
+}
+
+// GetListeningAddresses -> returns a copy of the unencrypted listening addresses
+func (s *Server) GetListeningAddresses() []string {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+	return append([]string{}, s.ListeningAddresses...)
+}
+
+// GetListeningAddressesSSL -> returns a copy of the encrypted listening addresses
+func (s *Server) GetListeningAddressesSSL() []string {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+	return append([]string{}, s.ListeningAddressesSSL...)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestAddListenerValidatesTheAddress(t *testing.T) {
+	s := newTestServer(t)
+	for _, address := range []string{"", "localhost", "127.0.0.1", "127.0.0.1:x", "127.0.0.1:70000", "127.0.0.1:80:80"} {
+		if s.AddListener(address, false) == nil {
+			t.Errorf("the address %q should be rejected", address)
+		}
+	}
+	for _, address := range []string{"127.0.0.1:8080", "127.0.0.1:8081+", ":8082"} {
+		if _err := s.AddListener(address, false); _err != nil {
+			t.Errorf("the address %q should be accepted: %v", address, _err)
+		}
+	}
+	if s.AddListener("127.0.0.1:8080", false) == nil {
+		t.Error("the duplicated address should be rejected")
+	}
+}
+
+// freeAddresses -> distinct local addresses which are not used right now
+func freeAddresses(t *testing.T, n int) []string {
+	t.Helper()
+	addresses := make([]string, n)
+	for i := range addresses {
+		l, _err := net.Listen("tcp", "127.0.0.1:0")
+		if _err != nil {
+			t.Fatal(_err)
+		}
+		// They're kept open until all the ports are found, so they're distinct
+		defer l.Close()
+		addresses[i] = l.Addr().String()
+	}
+	return addresses
+}
+
+// TestAddListenerWhileStarting -> each address added while the server is starting is served
+func TestAddListenerWhileStarting(t *testing.T) {
+	s := newTestServer(t)
+	// Many listeners are created on start, the addresses are added meanwhile
+	all := freeAddresses(t, 120)
+	addresses := all[100:]
+	s.ListeningAddresses = all[:100]
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	s.OnStart("add-listeners", func(s *Server) {
+		go func() {
+			defer wg.Done()
+			for _, address := range addresses {
+				if _err := s.AddListener(address, false); _err != nil {
+					t.Error(_err)
+				}
+			}
+		}()
+	})
+	if _err := s.Start(); _err != nil {
+		t.Fatal(_err)
+	}
+	defer s.Stop()
+	wg.Wait()
+
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+	for _, address := range s.ListeningAddresses {
+		if _, ok := s.listeners[listenerKey(address, false)]; !ok {
+			t.Errorf("the address %s is not served", address)
+		}
+	}
+}
@@ -1,9 +1,33 @@
 package server
 
 import (
+	"sync/atomic"
+
+	"github.com/kyaxcorp/go-logger"
 	"github.com/rs/zerolog"
 )
 
+// logLevelSampler -> filters the events by a level which can be changed at runtime (see SetLogLevel)
+// The zerolog logger is shared by the clients and the middlewares, replacing it while it's used is a data race
+type logLevelSampler struct {
+	level atomic.Int32
+}
+
+// newLogLevelSampler -> the level is the one from the config (logger.level)
+func newLogLevelSampler(level int) *logLevelSampler {
+	sampler := &logLevelSampler{}
+	sampler.set(level)
+	return sampler
+}
+
+func (l *logLevelSampler) set(level int) {
+	l.level.Store(int32(logger.ConvertConfigLogLevel(level)))
+}
+
+func (l *logLevelSampler) Sample(level zerolog.Level) bool {
+	return level >= zerolog.Level(l.level.Load())
+}
+
 // LDebug -> 0
 func (s *Server) LDebug() *zerolog.Event {
 	return s.Logger.Debug()
@@ -0,0 +1,245 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type presenceKind uint8
+
+const (
+	presenceUser presenceKind = iota
+	presenceDevice
+)
+
+type presenceEvent struct {
+	kind   presenceKind
+	id     string
+	online bool
+}
+
+// presenceCounter -> counts the connections of the users (or devices)
+type presenceCounter struct {
+	connections map[string]int
+	// offlineTimers -> the pending offline events (debounce), meanwhile the id is still online
+	offlineTimers map[string]*time.Timer
+}
+
+func newPresenceCounter() *presenceCounter {
+	return &presenceCounter{
+		connections:   make(map[string]int),
+		offlineTimers: make(map[string]*time.Timer),
+	}
+}
+
+// presenceTracker -> detects when the first connection of a user/device appears and when the last one goes away
+type presenceTracker struct {
+	lock     sync.Mutex
+	users    *presenceCounter
+	devices  *presenceCounter
+	debounce time.Duration
+
+	// The events are dispatched in order, by a single goroutine (started when there are events)
+	queueLock   sync.Mutex
+	queue       []presenceEvent
+	dispatching bool
+	handler     func(event presenceEvent)
+}
+
+func newPresenceTracker() *presenceTracker {
+	return &presenceTracker{
+		users:   newPresenceCounter(),
+		devices: newPresenceCounter(),
+	}
+}
+
+func (p *presenceTracker) counter(kind presenceKind) *presenceCounter {
+	if kind == presenceDevice {
+		return p.devices
+	}
+	return p.users
+}
+
+// connected -> a connection of the user/device has been registered
+func (p *presenceTracker) connected(userID string, deviceID string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.inc(presenceUser, userID)
+	p.inc(presenceDevice, deviceID)
+}
+
+// disconnected -> a connection of the user/device has been unregistered
+func (p *presenceTracker) disconnected(userID string, deviceID string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.dec(presenceUser, userID)
+	p.dec(presenceDevice, deviceID)
+}
+
+// inc -> the programmer should handle locks before!
+func (p *presenceTracker) inc(kind presenceKind, id string) {
+	if id == "" {
+		return
+	}
+	counter := p.counter(kind)
+	counter.connections[id]++
+	if counter.connections[id] > 1 {
+		return
+	}
+	// It has reconnected before the offline event
+	if timer, ok := counter.offlineTimers[id]; ok {
+		timer.Stop()
+		delete(counter.offlineTimers, id)
+		return
+	}
+	p.enqueue(presenceEvent{kind: kind, id: id, online: true})
+}
+
+// dec -> the programmer should handle locks before!
+func (p *presenceTracker) dec(kind presenceKind, id string) {
+	if id == "" {
+		return
+	}
+	counter := p.counter(kind)
+	if counter.connections[id] == 0 {
+		return
+	}
+	counter.connections[id]--
+	if counter.connections[id] > 0 {
+		return
+	}
+	delete(counter.connections, id)
+
+	if p.debounce <= 0 {
+		p.enqueue(presenceEvent{kind: kind, id: id, online: false})
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(p.debounce, func() {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		// It could have been stopped/replaced meanwhile
+		if counter.offlineTimers[id] != timer {
+			return
+		}
+		delete(counter.offlineTimers, id)
+		p.enqueue(presenceEvent{kind: kind, id: id, online: false})
+	})
+	counter.offlineTimers[id] = timer
+}
+
+func (p *presenceTracker) isOnline(kind presenceKind, id string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	counter := p.counter(kind)
+	if counter.connections[id] > 0 {
+		return true
+	}
+	_, pending := counter.offlineTimers[id]
+	return pending
+}
+
+func (p *presenceTracker) online(kind presenceKind) []string {
+	p.lock.Lock()
+	counter := p.counter(kind)
+	ids := make([]string, 0, len(counter.connections)+len(counter.offlineTimers))
+	for id := range counter.connections {
+		ids = append(ids, id)
+	}
+	for id := range counter.offlineTimers {
+		ids = append(ids, id)
+	}
+	p.lock.Unlock()
+	sort.Strings(ids)
+	return ids
+}
+
+func (p *presenceTracker) setDebounce(debounce time.Duration) {
+	p.lock.Lock()
+	p.debounce = debounce
+	p.lock.Unlock()
+}
+
+// enqueue -> the events are dispatched outside of the locks, in the same order
+func (p *presenceTracker) enqueue(event presenceEvent) {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+	if p.handler == nil {
+		return
+	}
+	p.queue = append(p.queue, event)
+	if p.dispatching {
+		return
+	}
+	p.dispatching = true
+	go p.dispatch()
+}
+
+func (p *presenceTracker) dispatch() {
+	for {
+		p.queueLock.Lock()
+		if len(p.queue) == 0 {
+			p.dispatching = false
+			p.queueLock.Unlock()
+			return
+		}
+		event := p.queue[0]
+		p.queue = p.queue[1:]
+		handler := p.handler
+		p.queueLock.Unlock()
+
+		handler(event)
+	}
+}
+
+//-------------------------------------\\
+
+// onPresenceEvent -> calls the callbacks of the event
+func (s *Server) onPresenceEvent(event presenceEvent) {
+	switch {
+	case event.kind == presenceUser && event.online:
+		s.onUserOnline.Scan(func(k string, v interface{}) {
+			v.(OnUserOnline)(event.id, s)
+		})
+	case event.kind == presenceUser:
+		s.onUserOffline.Scan(func(k string, v interface{}) {
+			v.(OnUserOffline)(event.id, s)
+		})
+	case event.online:
+		s.onDeviceOnline.Scan(func(k string, v interface{}) {
+			v.(OnDeviceOnline)(event.id, s)
+		})
+	default:
+		s.onDeviceOffline.Scan(func(k string, v interface{}) {
+			v.(OnDeviceOffline)(event.id, s)
+		})
+	}
+}
+
+// SetPresenceDebounce -> the offline events are fired only if the user/device hasn't reconnected in this time
+// Meanwhile, it's considered online
+func (s *Server) SetPresenceDebounce(debounce time.Duration) *Server {
+	s.c.presence.setDebounce(debounce)
+	return s
+}
+
+// IsUserOnline -> checks if the user has at least one connection
+func (s *Server) IsUserOnline(userID string) bool {
+	return s.c.presence.isOnline(presenceUser, userID)
+}
+
+// IsDeviceOnline -> checks if the device has at least one connection
+func (s *Server) IsDeviceOnline(deviceID string) bool {
+	return s.c.presence.isOnline(presenceDevice, deviceID)
+}
+
+// OnlineUsers -> the users which are online (sorted)
+func (s *Server) OnlineUsers() []string {
+	return s.c.presence.online(presenceUser)
+}
+
+// OnlineDevices -> the devices which are online (sorted)
+func (s *Server) OnlineDevices() []string {
+	return s.c.presence.online(presenceDevice)
+}
@@ -0,0 +1,305 @@
+package server
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+
+	"github.com/kyaxcorp/go-http/config"
+	loggerConfig "github.com/kyaxcorp/go-logger/config"
+	"github.com/rs/zerolog"
+)
+
+// ReloadResult -> what has been changed by ApplyConfig, the fields are identified by their yaml key path
+type ReloadResult struct {
+	// Applied -> the changes which have been applied live
+	Applied []string
+	// RequiresRestart -> the changes which will take effect only after a restart
+	RequiresRestart []string
+	// Failed -> the changes which couldn't be applied, the running value remains the old one
+	Failed map[string]error
+}
+
+// HasChanges -> if there was any difference between the running config and the new one
+func (r ReloadResult) HasChanges() bool {
+	return len(r.Applied) > 0 || len(r.RequiresRestart) > 0 || len(r.Failed) > 0
+}
+
+func (r *ReloadResult) applied(field string) {
+	r.Applied = append(r.Applied, field)
+}
+
+func (r *ReloadResult) requiresRestart(field string) {
+	r.RequiresRestart = append(r.RequiresRestart, field)
+}
+
+func (r *ReloadResult) failed(field string, err error) {
+	if r.Failed == nil {
+		r.Failed = make(map[string]error)
+	}
+	r.Failed[field] = err
+}
+
+// ApplyConfig -> compares the new config with the running one and applies the differences without a restart
+// The changes which cannot be applied live are listed in ReloadResult.RequiresRestart
+func (s *Server) ApplyConfig(newConfig config.Config) (ReloadResult, error) {
+	info := func() *zerolog.Event {
+		return s.LInfoF("ApplyConfig")
+	}
+	_error := func() *zerolog.Event {
+		return s.LErrorF("ApplyConfig")
+	}
+
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+
+	result := ReloadResult{}
+
+	s.LEvent("start", "OnBeforeReload", nil)
+	s.onBeforeReload.Scan(func(k string, v interface{}) {
+		v.(OnBeforeReload)(s, newConfig)
+	})
+	s.LEvent("finish", "OnBeforeReload", nil)
+
+	running := s.config
+
+	// Preparing the new config the same way as the constructor does
+	prepareLoggerConfig(&newConfig)
+	if _, _err := loggerConfig.DefaultConfig(&newConfig.Logger); _err != nil {
+		return result, s.reloadFailed(_err)
+	}
+	// The certificates have been generated on construction, we keep them
+	if newConfig.EnableSSL.Bool() && newConfig.SSLAutoGenerateCerts.Bool() &&
+		newConfig.SSLCertFilePath == "" && newConfig.SSLKeyFilePath == "" {
+		newConfig.SSLCertFilePath = running.SSLCertFilePath
+		newConfig.SSLKeyFilePath = running.SSLKeyFilePath
+	}
+
+	if _err := newConfig.Validate(); _err != nil {
+		_error().Err(_err).Msg("invalid config, nothing has been applied")
+		return result, s.reloadFailed(_err)
+	}
+
+	// These can be applied only by restarting
+	if running.Name != newConfig.Name {
+		result.requiresRestart("name")
+	}
+	if running.IsEnabled != newConfig.IsEnabled {
+		result.requiresRestart("is_enabled")
+	}
+	if running.EnableUnsecure != newConfig.EnableUnsecure {
+		result.requiresRestart("enable_unsecure")
+	}
+	if running.EnableSSL != newConfig.EnableSSL {
+		result.requiresRestart("enable_ssl")
+	}
+
+	if running.Description != newConfig.Description {
+		s.description.Set(newConfig.Description)
+		running.Description = newConfig.Description
+		result.applied("description")
+	}
+
+	// Listening addresses
+	if s.applyListeners(&result, "listening_addresses", s.GetListeningAddresses(), newConfig.ListeningAddresses, false) {
+		running.ListeningAddresses = s.GetListeningAddresses()
+	}
+	if s.applyListeners(&result, "listening_addresses_ssl", s.GetListeningAddressesSSL(), newConfig.ListeningAddressesSSL, true) {
+		running.ListeningAddressesSSL = s.GetListeningAddressesSSL()
+	}
+
+	// Status credentials
+	if running.ServerStatusUsername != newConfig.ServerStatusUsername ||
+		running.ServerStatusPassword != newConfig.ServerStatusPassword {
+		s.SetStatusCredentials(newConfig.ServerStatusUsername, newConfig.ServerStatusPassword)
+		if running.ServerStatusUsername != newConfig.ServerStatusUsername {
+			result.applied("server_status_username")
+		}
+		if running.ServerStatusPassword != newConfig.ServerStatusPassword {
+			result.applied("server_status_password")
+		}
+		running.ServerStatusUsername = newConfig.ServerStatusUsername
+		running.ServerStatusPassword = newConfig.ServerStatusPassword
+	}
+	if !reflect.DeepEqual(running.ServerStatusAccounts, newConfig.ServerStatusAccounts) {
+		s.SetStatusAccounts(statusAccountsFromConfig(newConfig.ServerStatusAccounts))
+		running.ServerStatusAccounts = newConfig.ServerStatusAccounts
+		result.applied("server_status_accounts")
+	}
+	if running.ServerStatusAllowInsecureDefaults != newConfig.ServerStatusAllowInsecureDefaults {
+		// It's used only by the validation
+		running.ServerStatusAllowInsecureDefaults = newConfig.ServerStatusAllowInsecureDefaults
+		result.applied("server_status_allow_insecure_defaults")
+	}
+	if running.EnableServerStatus != newConfig.EnableServerStatus {
+		if newConfig.EnableServerStatus.Bool() {
+			s.EnableServerStatus()
+		} else {
+			s.DisableServerStatus()
+		}
+		running.EnableServerStatus = newConfig.EnableServerStatus
+		result.applied("enable_server_status")
+	}
+
+	// Certificates
+	if running.SSLCertFilePath != newConfig.SSLCertFilePath || running.SSLKeyFilePath != newConfig.SSLKeyFilePath {
+		if _err := s.SetCertificates(newConfig.SSLCertFilePath, newConfig.SSLKeyFilePath); _err != nil {
+			result.failed("ssl_cert_file_path", _err)
+		} else {
+			if running.SSLCertFilePath != newConfig.SSLCertFilePath {
+				result.applied("ssl_cert_file_path")
+			}
+			if running.SSLKeyFilePath != newConfig.SSLKeyFilePath {
+				result.applied("ssl_key_file_path")
+			}
+			running.SSLCertFilePath = newConfig.SSLCertFilePath
+			running.SSLKeyFilePath = newConfig.SSLKeyFilePath
+		}
+	}
+	if running.SSLAutoGenerateCerts != newConfig.SSLAutoGenerateCerts {
+		// The certificates are generated only on construction
+		result.requiresRestart("ssl_auto_generate_certs")
+	}
+
+	// Session limits
+	if running.SessionLimits != newConfig.SessionLimits {
+		s.SetSessionLimits(newConfig.SessionLimits)
+		running.SessionLimits = newConfig.SessionLimits
+		result.applied("session_limits")
+	}
+
+	// Disconnect history
+	if !reflect.DeepEqual(running.DisconnectHistory, newConfig.DisconnectHistory) {
+		s.SetDisconnectHistory(newConfig.DisconnectHistory.Size, newConfig.DisconnectHistory.MaxAge)
+		s.SetDisconnectHistoryKinds(newConfig.DisconnectHistory.Kinds)
+		running.DisconnectHistory = newConfig.DisconnectHistory
+		result.applied("disconnect_history")
+	}
+
+	// Logger
+	if running.Logger.Level != newConfig.Logger.Level {
+		s.SetLogLevel(newConfig.Logger.Level)
+		running.Logger.Level = newConfig.Logger.Level
+		result.applied("logger.level")
+	}
+	newLogger := newConfig.Logger
+	newLogger.Level = running.Logger.Level
+	if !reflect.DeepEqual(running.Logger, newLogger) {
+		result.requiresRestart("logger")
+	}
+
+	s.config = running
+
+	info().
+		Strs("applied", result.Applied).
+		Strs("requires_restart", result.RequiresRestart).
+		Int("failed", len(result.Failed)).
+		Msg("config has been reloaded")
+
+	s.LEvent("start", "OnReloaded", nil)
+	s.onReloaded.Scan(func(k string, v interface{}) {
+		v.(OnReloaded)(s, result)
+	})
+	s.LEvent("finish", "OnReloaded", nil)
+
+	return result, nil
+}
+
+// applyListeners -> removes the missing addresses and adds the new ones, returns true if something has changed
+func (s *Server) applyListeners(
+	result *ReloadResult,
+	field string,
+	current []string,
+	addresses []string,
+	isSSL bool,
+) bool {
+	currentMap := make(map[string]bool)
+	for _, address := range current {
+		currentMap[address] = true
+	}
+	newMap := make(map[string]bool)
+	for _, address := range addresses {
+		newMap[address] = true
+	}
+
+	changed := false
+	for _, address := range current {
+		if newMap[address] {
+			continue
+		}
+		if _err := s.RemoveListener(address, isSSL); _err != nil {
+			result.failed(field, _err)
+			continue
+		}
+		changed = true
+	}
+	for _, address := range addresses {
+		if currentMap[address] {
+			continue
+		}
+		if _err := s.AddListener(address, isSSL); _err != nil {
+			result.failed(field, _err)
+			continue
+		}
+		changed = true
+	}
+	if changed {
+		result.applied(field)
+	}
+	return changed
+}
+
+func (s *Server) reloadFailed(err error) error {
+	s.LEvent("start", "OnReloadFailed", nil)
+	s.onReloadFailed.Scan(func(k string, v interface{}) {
+		v.(OnReloadFailed)(s, err)
+	})
+	s.LEvent("finish", "OnReloadFailed", nil)
+	return err
+}
+
+// SetLogLevel -> changes the level of the server logger (same values as logger.level from the config)
+func (s *Server) SetLogLevel(level int) *Server {
+	// The logger itself is not replaced, the level is checked by its sampler
+	s.logLevel.set(level)
+	return s
+}
+
+// ReloadOnSIGHUP -> on each SIGHUP signal, the config is taken from the loader and applied through ApplyConfig
+// It stops listening for the signal when the server context is done
+func (s *Server) ReloadOnSIGHUP(loader func() (config.Config, error)) *Server {
+	if loader == nil {
+		return s
+	}
+
+	ctx := s.parentCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				s.LInfoF("ReloadOnSIGHUP").Msg("received SIGHUP, reloading config")
+				newConfig, _err := loader()
+				if _err != nil {
+					s.LErrorF("ReloadOnSIGHUP").Err(_err).Msg("failed to load config")
+					s.reloadFailed(_err)
+					continue
+				}
+				// Errors are logged and passed to OnReloadFailed callbacks
+				_, _ = s.ApplyConfig(newConfig)
+			}
+		}
+	}()
+	return s
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kyaxcorp/go-http/config"
+	"github.com/kyaxcorp/go-http/middlewares/authentication"
+	"github.com/rs/zerolog"
+)
+
+// SessionLimitsOverride -> returns the limits for the user, it receives the limits from the config
+// It's called on each check, it should be fast (ex: read the plan from UserDetails.Details)
+type SessionLimitsOverride func(user authentication.UserDetails, limits config.SessionLimits) config.SessionLimits
+
+// SetSessionLimits -> replaces the limits from the config
+func (s *Server) SetSessionLimits(limits config.SessionLimits) *Server {
+	s.sessionLimitsLock.Lock()
+	s.sessionLimits = limits
+	s.sessionLimitsLock.Unlock()
+	return s
+}
+
+// SetSessionLimitsOverride -> the limits can be changed by user, set nil for removing the override
+func (s *Server) SetSessionLimitsOverride(override SessionLimitsOverride) *Server {
+	s.sessionLimitsLock.Lock()
+	s.sessionLimitsOverride = override
+	s.sessionLimitsLock.Unlock()
+	return s
+}
+
+// GetSessionLimits -> the limits applied to the user
+func (s *Server) GetSessionLimits(details *authentication.AuthDetails) config.SessionLimits {
+	s.sessionLimitsLock.RLock()
+	limits := s.sessionLimits
+	override := s.sessionLimitsOverride
+	s.sessionLimitsLock.RUnlock()
+	if override != nil && details != nil {
+		limits = override(details.UserDetails, limits)
+	}
+	return limits
+}
+
+// sessionLimit -> a limit on the clients sharing the same key
+type sessionLimit struct {
+	name     string
+	key      string
+	max      int
+	getIndex func(index *ClientsIndex) map[string]map[uint64]*Client
+}
+
+// checkSessionLimits -> returns false if the registered client has been rejected, in this case the request is
+// aborted and the client is disconnected
+// Depending on the policy, the oldest clients are disconnected for making room
+func (s *Server) checkSessionLimits(c *gin.Context, client *Client) bool {
+	// The checks are serialized, otherwise the concurrent clients could exceed the limits
+	s.sessionLimitsCheckLock.Lock()
+	defer s.sessionLimitsCheckLock.Unlock()
+	if !s.applySessionLimits(c, client) {
+		_ = client.Disconnect(SessionLimitRejectedReason)
+		return false
+	}
+	return true
+}
+
+// registerWithinSessionLimits -> registers the client only if it's not rejected by the limits, in this case
+// the request is aborted
+// The rejected client is never seen by the others (presence, history, callbacks)
+func (s *Server) registerWithinSessionLimits(c *gin.Context, client *Client) bool {
+	// The client should be counted by the next checks
+	s.sessionLimitsCheckLock.Lock()
+	defer s.sessionLimitsCheckLock.Unlock()
+	if !s.applySessionLimits(c, client) {
+		return false
+	}
+	s.c.registerClient(client)
+	return true
+}
+
+// applySessionLimits -> evicts the clients for making room, or aborts the request if it's not possible
+// sessionLimitsCheckLock should be held
+func (s *Server) applySessionLimits(c *gin.Context, client *Client) bool {
+	warn := func() *zerolog.Event {
+		return client.LWarnF("applySessionLimits")
+	}
+
+	details := client.GetAuthDetails()
+	limits := s.GetSessionLimits(details)
+	checks := []sessionLimit{
+		{"user", details.GetUserID(), limits.MaxPerUser, indexUsers},
+		{"device", details.GetDeviceID(), limits.MaxPerDevice, indexDevices},
+		{"auth_token", details.AuthTokenDetails.Token, limits.MaxPerAuthToken, indexAuthTokens},
+	}
+
+	evict := make(map[uint64]*Client)
+	for _, check := range checks {
+		if check.key == "" || check.max <= 0 {
+			continue
+		}
+		// The other active clients, the disconnecting ones don't count
+		others := make([]*Client, 0)
+		for connectionID, other := range s.c.getClientsByIndex(check.getIndex, check.key) {
+			if other == client || other.IsDisconnecting() || evict[connectionID] != nil {
+				continue
+			}
+			others = append(others, other)
+		}
+		excess := len(others) - check.max + 1
+		if excess <= 0 {
+			continue
+		}
+
+		candidates := others
+		switch limits.Policy {
+		case config.SessionLimitPolicyEvictOldest:
+		case config.SessionLimitPolicyEvictOldestSameDevice:
+			candidates = make([]*Client, 0, len(others))
+			if deviceID := details.GetDeviceID(); deviceID != "" {
+				for _, other := range others {
+					if other.GetDeviceID() == deviceID {
+						candidates = append(candidates, other)
+					}
+				}
+			}
+		default:
+			candidates = nil
+		}
+		if len(candidates) < excess {
+			warn().Str("limit", check.name).Int("max", check.max).Msg("session limit exceeded, rejecting the client")
+			s.rejectSession(c, limits.RejectStatusCode)
+			return false
+		}
+
+		// The connection ID's are incremental, the smallest ones are the oldest
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].connectionID < candidates[j].connectionID
+		})
+		for _, other := range candidates[:excess] {
+			evict[other.connectionID] = other
+		}
+	}
+
+	for _, other := range evict {
+		warn().Uint64("evicted_connection_id", other.connectionID).Msg("session limit exceeded, evicting the client")
+		_ = other.Disconnect(SessionLimitEvictedReason)
+	}
+	return true
+}
+
+func (s *Server) rejectSession(c *gin.Context, statusCode int) {
+	if statusCode == 0 {
+		statusCode = DefaultSessionLimitStatusCode
+	}
+	c.AbortWithStatusJSON(statusCode, gin.H{
+		"status":  false,
+		"code":    statusCode,
+		"message": SessionLimitRejectedReason,
+		"data":    nil,
+	})
+}
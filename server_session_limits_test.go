@@ -0,0 +1,139 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kyaxcorp/go-helper/_context"
+	"github.com/kyaxcorp/go-helper/sync/_bool"
+	"github.com/kyaxcorp/go-http/config"
+	"github.com/kyaxcorp/go-http/middlewares/authentication"
+	"github.com/kyaxcorp/go-logger/application"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	application.CreateAppLogger(application.MainLogOptions{Level: 5})
+	cfg, _err := config.DefaultConfig(nil)
+	if _err != nil {
+		t.Fatal(_err)
+	}
+	cfg.Name = "test"
+	cfg.EnableSSL = config.NewFlag(false)
+	cfg.ListeningAddresses = []string{"127.0.0.1:0"}
+	cfg.EnableServerStatus = config.NewFlag(false)
+	s, _err := New(_context.GetDefaultContext(), cfg)
+	if _err != nil {
+		t.Fatal(_err)
+	}
+	return s
+}
+
+// TestSessionLimitStopsTheAuthentication -> when the details are rejected, the OnTokenValid callback
+// is told to stop and the next handlers are not called
+func TestSessionLimitStopsTheAuthentication(t *testing.T) {
+	s := newTestServer(t)
+	// The policy and the status code are not set, the defaults are used (reject, 429)
+	s.SetSessionLimits(config.SessionLimits{MaxPerUser: 1})
+
+	// The user has already a client
+	existing := newIndexedClient(1000)
+	existing.isDisconnecting = _bool.New()
+	s.c.registerClient(existing)
+
+	var accepted, reachedNext bool
+	router := gin.New()
+	router.Use(s.clientsMiddleware())
+	router.GET("/stream", func(c *gin.Context) {
+		authentication.New().SetGinContext(c).OnTokenValid(func(a *authentication.Auth) {
+			if !a.SetAuthDetails(&authentication.AuthDetails{
+				UserDetails: authentication.UserDetails{UserID: existing.GetUserID()},
+			}) {
+				if !a.IsAborted() {
+					t.Error("the rejected request should be aborted")
+				}
+				return
+			}
+			accepted = true
+			c.Next()
+		}).OnTokenInValid(func(a *authentication.Auth) {
+			a.Abort(1, http.StatusUnauthorized, "unauthorized")
+		}).Check()
+	}, func(c *gin.Context) {
+		reachedNext = true
+		c.String(http.StatusOK, "ok")
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	request.Header.Set(authentication.DefaultHeaderAuthKey, "token")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	if accepted || reachedNext {
+		t.Errorf("the authentication should have stopped, accepted=%v next=%v", accepted, reachedNext)
+	}
+	if response.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the status %d, got %d", http.StatusTooManyRequests, response.Code)
+	}
+	if s.c.GetClientByID(existing.connectionID) != existing {
+		t.Error("the existing client should remain connected")
+	}
+	if nrOfClients := s.c.GetNrOfClients(); nrOfClients != 1 {
+		t.Errorf("the rejected client should be unregistered, got %d clients", nrOfClients)
+	}
+}
+
+// TestSessionLimitRejectsBeforeRegistering -> the client authenticated by a previous middleware is rejected
+// before being registered, it's not seen by the callbacks, the presence and the history
+func TestSessionLimitRejectsBeforeRegistering(t *testing.T) {
+	s := newTestServer(t)
+	s.SetSessionLimits(config.SessionLimits{MaxPerUser: 1})
+
+	existing := newIndexedClient(1000)
+	existing.isDisconnecting = _bool.New()
+	s.c.registerClient(existing)
+
+	seen := _bool.New()
+	s.OnRequest("test", func(c *Client, s *Server) {
+		seen.True()
+	})
+	s.OnDeviceOnline("test", func(deviceID string, s *Server) {
+		if deviceID == "new-device" {
+			seen.True()
+		}
+	})
+
+	reachedNext := false
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(authentication.HttpContextAuthDetailsKey, &authentication.AuthDetails{
+			UserDetails:   authentication.UserDetails{UserID: existing.GetUserID()},
+			DeviceDetails: authentication.DeviceDetails{DeviceID: "new-device"},
+		})
+	}, s.clientsMiddleware())
+	router.GET("/stream", func(c *gin.Context) {
+		reachedNext = true
+		c.String(http.StatusOK, "ok")
+	})
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/stream", nil))
+
+	if reachedNext || response.Code != http.StatusTooManyRequests {
+		t.Errorf("the client should be rejected with %d, got %d next=%v", http.StatusTooManyRequests, response.Code, reachedNext)
+	}
+	if nrOfClients := s.c.GetNrOfClients(); nrOfClients != 1 {
+		t.Errorf("expected only the existing client, got %d clients", nrOfClients)
+	}
+	if entries := s.RecentDisconnects(FindClientsFilter{All: true}); len(entries) != 0 {
+		t.Errorf("the rejected client should not be recorded, got %+v", entries)
+	}
+	// The callbacks are called in goroutines
+	time.Sleep(50 * time.Millisecond)
+	if seen.Get() {
+		t.Error("the callbacks have been called for the rejected client")
+	}
+}
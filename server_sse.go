@@ -0,0 +1,250 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// SSEEvent -> a Server-Sent Event, the ID is generated on Broadcast
+type SSEEvent struct {
+	// Event -> the event name, if empty the browser fires "message"
+	Event string
+	Data  string
+}
+
+// encode -> the event in the text/event-stream format
+func (e SSEEvent) encode(id uint64) []byte {
+	var b bytes.Buffer
+	b.WriteString("id: ")
+	b.WriteString(strconv.FormatUint(id, 10))
+	b.WriteByte('\n')
+	if e.Event != "" {
+		b.WriteString("event: ")
+		b.WriteString(e.Event)
+		b.WriteByte('\n')
+	}
+	// Each line of data should be prefixed
+	for _, line := range strings.Split(e.Data, "\n") {
+		b.WriteString("data: ")
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+// sseEventID -> reads the ID from the encoded event
+func sseEventID(payload []byte) uint64 {
+	line, _, _ := bytes.Cut(payload, []byte("\n"))
+	id, _ := strconv.ParseUint(string(bytes.TrimPrefix(line, []byte("id: "))), 10, 64)
+	return id
+}
+
+type sseBufferedEvent struct {
+	id      uint64
+	filter  FindClientsFilter
+	payload []byte
+}
+
+// sseHub -> generates the event ID's and keeps the last broadcast events for Last-Event-ID replay
+type sseHub struct {
+	lock   sync.Mutex
+	lastID uint64
+	// buffer -> a ring buffer, next is the position of the oldest event when the buffer is full
+	buffer []sseBufferedEvent
+	next   int
+	size   int
+}
+
+func newSSEHub(size int) *sseHub {
+	return &sseHub{
+		buffer: make([]sseBufferedEvent, 0, size),
+		size:   size,
+	}
+}
+
+// add -> generates the ID and keeps the event, the filter should be prepared before
+func (h *sseHub) add(filter FindClientsFilter, event SSEEvent) (uint64, []byte) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.lastID++
+	buffered := sseBufferedEvent{
+		id:      h.lastID,
+		filter:  filter,
+		payload: event.encode(h.lastID),
+	}
+	if h.size > 0 {
+		if len(h.buffer) < h.size {
+			h.buffer = append(h.buffer, buffered)
+		} else {
+			h.buffer[h.next] = buffered
+			h.next = (h.next + 1) % h.size
+		}
+	}
+	return buffered.id, buffered.payload
+}
+
+// since -> the kept events after the ID which are matching the client, from the oldest one
+func (h *sseHub) since(lastEventID uint64, client *Client) [][]byte {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	var payloads [][]byte
+	for i := 0; i < len(h.buffer); i++ {
+		buffered := &h.buffer[(h.next+i)%len(h.buffer)]
+		if buffered.id <= lastEventID {
+			continue
+		}
+		if buffered.filter.matches(client) {
+			payloads = append(payloads, buffered.payload)
+		}
+	}
+	return payloads
+}
+
+// Broadcast -> sends the event to the SSE clients found by the filter, when a ClusterRegistry is set it's
+// sent to the other nodes too
+// The event is kept for a while, so the clients reconnecting with Last-Event-ID will receive it
+// It returns the nr. of clients of this node to which the event has been queued
+func (s *Server) Broadcast(filter FindClientsFilter, event SSEEvent) int {
+	nrOfQueued := s.broadcastLocal(filter, event)
+	if _err := s.GetClientsRegistry().Broadcast(filter, event); _err != nil {
+		s.LWarnF("Broadcast").Err(_err).Msg("failed to send the event to the other nodes")
+	}
+	return nrOfQueued
+}
+
+// broadcastLocal -> sends the event to the SSE clients of this node
+func (s *Server) broadcastLocal(filter FindClientsFilter, event SSEEvent) int {
+	prepareFilter(&filter)
+	_, payload := s.sse.add(filter, event)
+
+	nrOfQueued := 0
+	for _, client := range s.c.getClientsByFilter(filter) {
+		if client.enqueue(sendKindSSE, payload) {
+			nrOfQueued++
+		}
+	}
+	return nrOfQueued
+}
+
+// SSE -> registers a GET route which streams the broadcast events to the client
+// The handlers are called before the stream, they can be used for authentication
+func (s *Server) SSE(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return s.HttpServer.GET(relativePath, append(handlers, s.SSEHandler())...)
+}
+
+// SSEHandler -> streams the send queue of the client with heartbeats, until the request is done or
+// the client is disconnected
+func (s *Server) SSEHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client := GetClientFromCtx(c)
+		if client == nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		info := func() *zerolog.Event {
+			return client.LInfoF("SSEHandler")
+		}
+
+		send := client.startSending(sendKindSSE, DefaultSSESendBufferSize)
+		defer client.stopSending()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		// Disable the proxy buffering (nginx)
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+
+		write := func(payload []byte) bool {
+			if _, _err := c.Writer.Write(payload); _err != nil {
+				return false
+			}
+			c.Writer.Flush()
+			return true
+		}
+		stream := &sseStream{client: client, write: write}
+
+		// Replay the missed events
+		lastEventID := c.GetHeader("Last-Event-ID")
+		if lastEventID == "" {
+			// The EventSource polyfills are sending it as query param
+			lastEventID = c.Query("lastEventId")
+		}
+		if lastEventID != "" {
+			if id, _err := strconv.ParseUint(lastEventID, 10, 64); _err == nil {
+				if !stream.replay(s.sse.since(id, client)) {
+					return
+				}
+			}
+		}
+		c.Writer.Flush()
+
+		client.writeTicker = time.NewTicker(DefaultSSEHeartbeatInterval)
+		defer client.writeTicker.Stop()
+
+		info().Msg("streaming...")
+		defer info().Msg("stream finished")
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case payload := <-send:
+				if !stream.deliver(payload) {
+					return
+				}
+			case <-client.writeTicker.C:
+				// Comment lines are ignored by the browser, they keep the connection open
+				if !write([]byte(": heartbeat\n\n")) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// sseStream -> writes the replayed and the queued events of the client
+type sseStream struct {
+	client *Client
+	write  func(payload []byte) bool
+	// replayedUpTo -> the events broadcast while replaying are also queued, they're skipped by their ID
+	replayedUpTo uint64
+}
+
+func (st *sseStream) send(payload []byte) bool {
+	if !st.write(payload) {
+		st.client.messageFailed()
+		return false
+	}
+	st.client.messageSent()
+	return true
+}
+
+// replay -> writes the missed events, it returns false if the client can't be written
+func (st *sseStream) replay(payloads [][]byte) bool {
+	for _, payload := range payloads {
+		st.client.messageQueued()
+		if !st.send(payload) {
+			return false
+		}
+		st.replayedUpTo = sseEventID(payload)
+	}
+	return true
+}
+
+// deliver -> writes the queued event, unless it has been replayed
+func (st *sseStream) deliver(payload []byte) bool {
+	if st.replayedUpTo > 0 && sseEventID(payload) <= st.replayedUpTo {
+		// The live copy of a replayed event, it has been counted by both
+		st.client.messageDuplicated()
+		return true
+	}
+	return st.send(payload)
+}
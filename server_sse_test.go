@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestSSEReplayCounters -> the events broadcast between the start of the stream and the replay are queued and
+// replayed, they're written once and each queued message is counted as sent or failed
+func TestSSEReplayCounters(t *testing.T) {
+	s := newTestServer(t)
+	all := FindClientsFilter{All: true}
+	// Missed by the client
+	for i := 0; i < 3; i++ {
+		s.Broadcast(all, SSEEvent{Data: "missed"})
+	}
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	client := s.newClient(ctx)
+	s.c.registerClient(client)
+	defer s.c.unregisterClient(client)
+	send := client.startSending(sendKindSSE, 16)
+	defer client.stopSending()
+
+	// Broadcast before the replay, they're queued and kept for the replay too
+	for i := 0; i < 2; i++ {
+		if s.Broadcast(all, SSEEvent{Data: "live"}) != 1 {
+			t.Fatal("the event hasn't been queued")
+		}
+	}
+
+	received := make(map[uint64]int)
+	stream := &sseStream{client: client, write: func(payload []byte) bool {
+		received[sseEventID(payload)]++
+		return true
+	}}
+	if !stream.replay(s.sse.since(1, client)) {
+		t.Fatal("the replay has failed")
+	}
+	// Broadcast after the replay
+	s.Broadcast(all, SSEEvent{Data: "live"})
+	for len(send) > 0 {
+		if !stream.deliver(<-send) {
+			t.Fatal("the delivery has failed")
+		}
+	}
+
+	for id := uint64(2); id <= 6; id++ {
+		if received[id] != 1 {
+			t.Errorf("the event %d has been written %d times", id, received[id])
+		}
+	}
+	if len(received) != 5 {
+		t.Errorf("expected 5 written events, got %d", len(received))
+	}
+	queued, sent, failed := client.GetNrOfSentMessages(), client.GetNrOfSentSuccessMessages(), client.GetNrOfSentFailedMessages()
+	if queued != 5 || sent != 5 || failed != 0 {
+		t.Errorf("expected 5 queued and sent messages, got %d queued, %d sent, %d failed", queued, sent, failed)
+	}
+	if serverQueued := s.GetTrafficStatus().NrOfSentMessages; serverQueued != queued {
+		t.Errorf("expected %d messages queued by the server, got %d", queued, serverQueued)
+	}
+}
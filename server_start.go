@@ -1,15 +1,8 @@
 package server
 
 import (
-	"crypto/tls"
-	"flag"
-	"net/http"
-	"strings"
-
-	"github.com/gookit/color"
 	"github.com/kyaxcorp/go-helper/_context"
 	"github.com/kyaxcorp/go-helper/errors2/define"
-	"github.com/kyaxcorp/go-helper/network/port"
 	"github.com/rs/zerolog"
 )
 
@@ -47,8 +40,8 @@ func (s *Server) Start() error {
 	// Check if the server is stopped
 	if !s.isStopped.Get() {
 		// The server is not stopped... so it cannot start
-		warn().Msg("server already stopped")
-		return define.Err(0, "server already stopped")
+		warn().Msg("server already started")
+		return define.Err(0, "server already started")
 	}
 
 	// Check if start command was called
@@ -68,222 +61,60 @@ func (s *Server) Start() error {
 	// We create each time when we start the server!
 	s.ctx = _context.WithCancel(s.parentCtx)
 
+	// The listeners added by AddListener are served by us or by AddListener, the lock is held until the
+	// server is marked as started
+	s.listenersLock.Lock()
+
 	info().Msg("creating http instances for secure and unsecure servers")
-	// Standard instances
-	instances := make(map[string]*http.Server)
-	// SSL instances
-	instancesSSL := make(map[string]*http.Server)
+	listeners := make(map[string]*listener)
 
 	// Creating non-secure http server
 	if s.enableUnsecure {
 		info().Msg("unsecure listening is enabled")
 		for _, listeningAddress := range s.ListeningAddresses {
-			var addr *string
-
 			if listeningAddress == "" {
 				continue
 			}
-
-			searchFreePort := false
-			if strings.Contains(listeningAddress, "+") {
-				searchFreePort = true
-			}
-			listeningAddress = port.FilterAddress(listeningAddress)
-
-			if !searchFreePort {
-				if busy, _err := port.IsTCPBusy(listeningAddress); busy {
-					_error().
-						Err(_err).
-						Str("listening_address", listeningAddress).
-						Msg("listening address already busy")
-					continue
-				}
-			} else {
-				newListeningAddress, _err := port.SearchAndLockFreeTCPAddress(listeningAddress)
-				if _err != nil {
-					_error().
-						Err(_err).
-						Str("new_listening_address", newListeningAddress).
-						Str("listening_address", listeningAddress).
-						Msg("listening address already busy")
-					continue
-				}
-				if listeningAddress != newListeningAddress {
-					warn().
-						Str("new_listening_address", newListeningAddress).
-						Str("listening_address", listeningAddress).
-						Msg("auto binding is enabled, listening address has been changed")
-				}
-
-				listeningAddress = newListeningAddress
-			}
-
-			// Creating the address flag
-			addr = flag.String("webHttpServer", listeningAddress, "HTTP Server")
-			// Saving the instance
-			if addr == nil {
-				_error().Str("listening_address", listeningAddress).Msg("addr is nil")
+			l, _err := s.createListener(listeningAddress, false)
+			if _err != nil {
 				continue
 			}
-			info().
-				Str("listening_on", listeningAddress).
-				Str("listening_addr", *addr).
-				Msg("creating http instance")
-			instances[listeningAddress] = &http.Server{
-				Addr:    *addr,
-				Handler: s.HttpServer,
-			}
+			listeners[listenerKey(listeningAddress, false)] = l
 		}
 	}
 
 	// Creating secure http server
 	if s.enableSSL {
 		info().Msg("secure listening is enabled")
-		for _, listeningAddress := range s.ListeningAddressesSSL {
-			var addrSSL *string
-
-			if listeningAddress == "" {
-				continue
-			}
-
-			searchFreePort := false
-			if strings.Contains(listeningAddress, "+") {
-				searchFreePort = true
-			}
-			listeningAddress = port.FilterAddress(listeningAddress)
-
-			if !searchFreePort {
-				if busy, _err := port.IsTCPBusy(listeningAddress); busy {
-					_error().
-						Err(_err).
-						Str("listening_address", listeningAddress).
-						Msg("listening address already busy")
+		if _err := s.loadCertificate(); _err != nil {
+			_error().Err(_err).Msg("failed to load certificates, secure listening is skipped")
+		} else {
+			for _, listeningAddress := range s.ListeningAddressesSSL {
+				if listeningAddress == "" {
 					continue
 				}
-			} else {
-				newListeningAddress, _err := port.SearchAndLockFreeTCPAddress(listeningAddress)
+				l, _err := s.createListener(listeningAddress, true)
 				if _err != nil {
-					_error().
-						Err(_err).
-						Str("new_listening_address", newListeningAddress).
-						Str("listening_address", listeningAddress).
-						Msg("listening address already busy")
 					continue
 				}
-				if listeningAddress != newListeningAddress {
-					warn().
-						Str("new_listening_address", newListeningAddress).
-						Str("listening_address", listeningAddress).
-						Msg("auto binding is enabled, listening address has been changed")
-				}
-
-				listeningAddress = newListeningAddress
-			}
-
-			addrSSL = flag.String("webHttpServerSSL", listeningAddress, "HTTP Server SSL")
-			if addrSSL == nil {
-				_error().Str("listening_address", listeningAddress).Msg("addrSSL is nil")
-				continue
-			}
-			info().
-				Str("listening_ssl_on", listeningAddress).
-				Str("listening_ssl_addr", *addrSSL).
-				Msg("creating http(s) instance")
-
-			cert, _err := tls.LoadX509KeyPair(s.sslCertPath, s.sslKeyPath)
-			if _err != nil {
-				_error().Str("listening_address", listeningAddress).Msg("failed to load certificates")
-				continue
-			}
-			/*tlsConfig, _err := connhelpers.TlsConfigWithHttp2Enabled(&tls.Config{
-				Certificates: []tls.Certificate{cert},
-			})
-			if _err != nil {
-				_error().Str("listening_address", listeningAddress).Msg("failed to prepare config with http2 enabled")
-				continue
-			}*/
-			// By leaving the auto-configuration, the app already will have http/2 enabled!
-
-			instancesSSL[listeningAddress] = &http.Server{
-				Addr:    *addrSSL,
-				Handler: s.HttpServer,
-				TLSConfig: &tls.Config{
-					Certificates: []tls.Certificate{cert},
-				},
+				listeners[listenerKey(listeningAddress, true)] = l
 			}
 		}
 	}
 
+	s.listeners = listeners
+
 	// This routine will handle termination of the server!
 	go func() {
-		terminate := false
-		for {
-			select {
-			case <-s.ctx.Done():
-				// TODO: Stop Listeners!
-				//s.WSServer
-				terminate = true
-				info().Msg("terminating...")
-
-				// Shutdown standard instances
-				if s.enableUnsecure {
-					for listeningAddress, instance := range instances {
-						info().Str("shutting_down", listeningAddress).Msg("shutting down server")
-						_err := instance.Shutdown(s.ctx.Context())
-						if _err != nil {
-							_error().Err(_err).Msg("failed shutting down http server")
-						}
-					}
-				}
-				// Shutdown SSL instances
-				if s.enableSSL {
-					for listeningAddress, instance := range instancesSSL {
-						info().Str("shutting_down", listeningAddress).Msg("shutting down server")
-						_err := instance.Shutdown(s.ctx.Context())
-						if _err != nil {
-							_error().Err(_err).Msg("failed shutting down http server")
-						}
-					}
-				}
-			}
-			if terminate {
-				break
-			}
-		}
+		<-s.ctx.Done()
+		info().Msg("terminating...")
+		// Shutdown standard and SSL instances (including the ones added at runtime)
+		s.shutdownListeners(s.ctx.Context())
 	}()
 
-	// Listen for unencrypted/plain connections
-	if s.enableUnsecure {
-		for listeningAddress, instance := range instances {
-			info().Str("running_on", listeningAddress).Msg("running http server")
-			go func(instance *http.Server) {
-				// TODO: make a callback for fail listening!
-				//err := s.WSServer.Run(*addr)
-				_err := instance.ListenAndServe()
-				if _err != nil {
-					_error().Err(_err).Msg(color.Style{color.LightRed}.Render("failed to listen http server"))
-				}
-			}(instance)
-		}
-	}
-
-	// Listen for SSL Connections
-	if s.enableSSL {
-		//TODO: SSL SERVER IS CPU CONSUMING!!!! even with no connections -> ONLY ON WINDOWS!!!!!
-		for listeningAddress, instance := range instancesSSL {
-			info().Str("running_on", listeningAddress).Msg("running http(s) server")
-			go func(instance *http.Server) {
-				// TODO: make a callback for fail listening!
-				//log.Println("enabling SSL Connections")
-				//err := s.WSServer.RunTLS(*addrSSL, s.sslCertPath, s.sslKeyPath)
-				//_err := instance.ListenAndServeTLS(s.sslCertPath, s.sslKeyPath)
-				_err := instance.ListenAndServeTLS("", "")
-				//_err := instance.ListenAndServe()
-				if _err != nil {
-					_error().Err(_err).Msg(color.Style{color.LightRed}.Render("failed to listen http SSL server"))
-				}
-			}(instance)
-		}
+	// Listen for unencrypted/plain and SSL connections
+	for _, l := range listeners {
+		s.serveListener(l)
 	}
 
 	s.startTime.SetNow()
@@ -291,6 +122,9 @@ func (s *Server) Start() error {
 	// TODO: but we will know that's listening?! after 1 second? or instantly!
 	// Set server as Started!
 	s.isStarted.True()
+	s.listenersLock.Unlock()
+
+	s.isStopped.False()
 	// Set that start command has finished
 	s.isStartCalled.False()
 
@@ -1,11 +1,15 @@
 package server
 
 import (
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kyaxcorp/go-helper/errors2/define"
 	"github.com/kyaxcorp/go-helper/info"
+	"github.com/kyaxcorp/go-http/middlewares/status_auth"
 )
 
 type ClientDetails struct {
@@ -17,22 +21,59 @@ type ClientDetails struct {
 	ConnectedSeconds int64
 	UserID           string
 	DeviceID         string
+	Rooms            []string
+
+	// Traffic
+	// NrOfRequests -> the request itself and the websocket messages received after the upgrade
+	NrOfRequests            uint64
+	BytesIn                 uint64
+	BytesOut                uint64
+	NrOfReceivedMessages    uint64
+	NrOfSentMessages        uint64
+	NrOfSentFailedMessages  uint64
+	NrOfSentSuccessMessages uint64
+	LastActivityAt          time.Time
 }
 
 type ClientsStatus struct {
+	// NrOfClients -> the nr. of connected clients
 	NrOfClients int64
-	Clients     map[int64]ClientDetails
+	// Returned -> the nr. of clients from this page
+	Returned int64
+	Clients  []ClientDetails
+	// NextCursor -> pass it as "after" for getting the next page
+	NextCursor string
+}
+
+// ClientsHistoryStatus -> the recently disconnected clients, the newest first
+type ClientsHistoryStatus struct {
+	NrOfClients int64
+	Clients     []DisconnectedClient
 }
 
 type FullStatus struct {
 	Name                  string
+	Description           string
 	ListeningAddresses    []string
 	ListeningAddressesSSL []string
 	CurrentConnectionID   uint64
 	NrOfClients           uint
+	NrOfRooms             int
+	Traffic               TrafficStatus
 	SystemStatus          info.SystemStatus
 }
 
+type ConfigStatus struct {
+	Name   string
+	Config map[string]interface{}
+}
+
+type RoomsStatus struct {
+	NrOfRooms int
+	// Rooms -> the nr. of clients by room
+	Rooms map[string]int
+}
+
 type SystemStatus struct {
 	SystemStatus info.SystemStatus
 }
@@ -44,6 +85,7 @@ type NrOfClientsStatus struct {
 
 type Status struct {
 	Name                  string
+	Description           string
 	ListeningAddresses    []string
 	ListeningAddressesSSL []string
 	CurrentConnectionID   uint64
@@ -57,11 +99,14 @@ func (s *FullStatus) Collect() {
 func (s *Server) Status(onCollected func(status FullStatus)) {
 	go func() {
 		status := FullStatus{
-			Name:                  "",
-			ListeningAddresses:    s.ListeningAddresses,
-			ListeningAddressesSSL: s.ListeningAddressesSSL,
+			Name:                  s.Name,
+			Description:           s.GetDescription(),
+			ListeningAddresses:    s.GetListeningAddresses(),
+			ListeningAddressesSSL: s.GetListeningAddressesSSL(),
 			CurrentConnectionID:   s.connectionID.Get(),
 			NrOfClients:           s.GetNrOfClients(),
+			NrOfRooms:             len(s.Rooms()),
+			Traffic:               s.GetTrafficStatus(),
 			SystemStatus:          info.GetSystemStatus(),
 		}
 
@@ -83,15 +128,21 @@ func (s *Server) StatusSystemStatus(onCollected func(status SystemStatus)) {
 	}()
 }
 
+// GetServerStatus -> same as ServerStatus, but it's collected in the current goroutine
+func (s *Server) GetServerStatus() Status {
+	return Status{
+		Name:                  s.Name,
+		Description:           s.GetDescription(),
+		ListeningAddresses:    s.GetListeningAddresses(),
+		ListeningAddressesSSL: s.GetListeningAddressesSSL(),
+		CurrentConnectionID:   s.connectionID.Get(),
+		NrOfClients:           s.GetNrOfClients(),
+	}
+}
+
 func (s *Server) ServerStatus(onCollected func(status Status)) {
 	go func() {
-		status := Status{
-			Name:                  "",
-			ListeningAddresses:    s.ListeningAddresses,
-			ListeningAddressesSSL: s.ListeningAddressesSSL,
-			CurrentConnectionID:   s.connectionID.Get(),
-			NrOfClients:           s.GetNrOfClients(),
-		}
+		status := s.GetServerStatus()
 
 		if onCollected != nil {
 			onCollected(status)
@@ -99,12 +150,17 @@ func (s *Server) ServerStatus(onCollected func(status Status)) {
 	}()
 }
 
+// GetNrOfClientsStatus -> same as StatusNrOfClients, but it's collected in the current goroutine
+func (s *Server) GetNrOfClientsStatus() NrOfClientsStatus {
+	return NrOfClientsStatus{
+		CurrentConnectionID: s.connectionID.Get(),
+		NrOfClients:         s.GetNrOfClients(),
+	}
+}
+
 func (s *Server) StatusNrOfClients(onCollected func(status NrOfClientsStatus)) {
 	go func() {
-		status := NrOfClientsStatus{
-			CurrentConnectionID: s.connectionID.Get(),
-			NrOfClients:         s.GetNrOfClients(),
-		}
+		status := s.GetNrOfClientsStatus()
 
 		if onCollected != nil {
 			onCollected(status)
@@ -112,45 +168,164 @@ func (s *Server) StatusNrOfClients(onCollected func(status NrOfClientsStatus)) {
 	}()
 }
 
-func (s *Server) ClientsStatus(onCollected func(clients ClientsStatus)) {
+// GetRoomsStatus -> the nr. of clients by room
+func (s *Server) GetRoomsStatus() RoomsStatus {
+	rooms := s.Rooms()
+	return RoomsStatus{
+		NrOfRooms: len(rooms),
+		Rooms:     rooms,
+	}
+}
+
+func (s *Server) RoomsStatus(onCollected func(status RoomsStatus)) {
 	go func() {
+		status := s.GetRoomsStatus()
 
-		/*
-			IP
-			Device ID
-			Connected Time
-		*/
-
-		now := time.Now()
-
-		currentClients := s.GetClientsOrderedByConnectionID()
-
-		var cls = make(map[int64]ClientDetails)
-		for _, c := range currentClients {
-			cls[int64(c.connectionID)] = ClientDetails{
-				ConnectionID:     int64(c.connectionID),
-				ClientIP:         c.GetIPAddress(),
-				RemoteIP:         c.GetRemoteIP(),
-				RequestPath:      c.GetRequestPath(),
-				ConnectedAt:      c.connectTime,
-				ConnectedSeconds: now.Unix() - c.connectTime.Unix(),
-				UserID:           c.GetUserID(),
-				DeviceID:         c.GetDeviceID(),
-			}
+		if onCollected != nil {
+			onCollected(status)
 		}
+	}()
+}
 
-		clientsStatus := ClientsStatus{
-			NrOfClients: int64(len(cls)),
-			Clients:     cls,
+func (s *Server) ConfigStatus(onCollected func(status ConfigStatus)) {
+	go func() {
+		status := ConfigStatus{
+			Name:   s.Name,
+			Config: s.EffectiveConfig(),
 		}
 
+		if onCollected != nil {
+			onCollected(status)
+		}
+	}()
+}
+
+// newClientDetails -> the details shown in the status
+func newClientDetails(c *Client) ClientDetails {
+	return ClientDetails{
+		ConnectionID:     int64(c.connectionID),
+		ClientIP:         c.GetIPAddress(),
+		RemoteIP:         c.GetRemoteIP(),
+		RequestPath:      c.GetRequestPath(),
+		ConnectedAt:      c.connectTime,
+		ConnectedSeconds: c.GetConnectedTimeSeconds(),
+		UserID:           c.GetUserID(),
+		DeviceID:         c.GetDeviceID(),
+		Rooms:            c.Rooms(),
+
+		NrOfRequests:            c.GetNrOfRequests(),
+		BytesIn:                 c.GetBytesIn(),
+		BytesOut:                c.GetBytesOut(),
+		NrOfReceivedMessages:    c.GetNrOfReceivedMessages(),
+		NrOfSentMessages:        c.GetNrOfSentMessages(),
+		NrOfSentFailedMessages:  c.GetNrOfSentFailedMessages(),
+		NrOfSentSuccessMessages: c.GetNrOfSentSuccessMessages(),
+		LastActivityAt:          c.GetLastActivity(),
+	}
+}
+
+// GetClientsStatus -> returns the details of the clients from the page
+func (s *Server) GetClientsStatus(options ClientsPageOptions) (ClientsStatus, error) {
+	/*
+		IP
+		Device ID
+		Connected Time
+	*/
+
+	page, _err := s.GetClientsPage(options)
+	if _err != nil {
+		return ClientsStatus{}, _err
+	}
+
+	cls := make([]ClientDetails, 0, len(page.Clients))
+	for _, c := range page.Clients {
+		cls = append(cls, newClientDetails(c))
+	}
+
+	return ClientsStatus{
+		NrOfClients: int64(s.GetNrOfClients()),
+		Returned:    int64(len(cls)),
+		Clients:     cls,
+		NextCursor:  page.NextCursor,
+	}, nil
+}
+
+// ClientsStatus -> collects the details of all the clients, ordered by connection ID
+func (s *Server) ClientsStatus(onCollected func(clients ClientsStatus)) {
+	go func() {
+		clientsStatus, _ := s.GetClientsStatus(ClientsPageOptions{})
+
 		if onCollected != nil {
 			onCollected(clientsStatus)
 		}
 	}()
 }
 
-func (s *Server) startServerStatus() *Server {
+// clientsPageOptionsFromRequest -> reads the options from ?limit=&after=&sort=&user=&ip=
+// user and ip can be repeated, the clients should match all the defined params
+func clientsPageOptionsFromRequest(context *gin.Context) (ClientsPageOptions, error) {
+	options := ClientsPageOptions{
+		Sort:  ClientsSort(context.Query("sort")),
+		After: context.Query("after"),
+	}
+	if limit := context.Query("limit"); limit != "" {
+		l, _err := strconv.Atoi(limit)
+		if _err != nil {
+			return options, define.Err(0, "invalid clients limit", limit)
+		}
+		options.Limit = l
+	}
+
+	var queries []*ClientQuery
+	if users := context.QueryArray("user"); len(users) > 0 {
+		queries = append(queries, QueryUsers(users...))
+	}
+	if ips := context.QueryArray("ip"); len(ips) > 0 {
+		queries = append(queries, QueryIPAddresses(ips...))
+	}
+	if len(queries) > 0 {
+		options.Query = And(queries...)
+	}
+	return options, nil
+}
+
+// GetClientsHistoryStatus -> at most limit recently disconnected clients (all of them if limit <= 0)
+func (s *Server) GetClientsHistoryStatus(filter FindClientsFilter, limit int) ClientsHistoryStatus {
+	clients := s.RecentDisconnects(filter)
+	if limit > 0 && len(clients) > limit {
+		clients = clients[:limit]
+	}
+	return ClientsHistoryStatus{
+		NrOfClients: int64(len(clients)),
+		Clients:     clients,
+	}
+}
+
+// clientsHistoryFilterFromRequest -> reads limit, user, device, ip and room from the query string
+// Without any of user/device/ip/room, all the clients are returned
+func clientsHistoryFilterFromRequest(context *gin.Context) (FindClientsFilter, int, error) {
+	filter := FindClientsFilter{
+		Users:       context.QueryArray("user"),
+		Devices:     context.QueryArray("device"),
+		IPAddresses: context.QueryArray("ip"),
+		Rooms:       context.QueryArray("room"),
+	}
+	filter.All = len(filter.Users) == 0 && len(filter.Devices) == 0 &&
+		len(filter.IPAddresses) == 0 && len(filter.Rooms) == 0
+
+	limit := 0
+	if l := context.Query("limit"); l != "" {
+		var _err error
+		if limit, _err = strconv.Atoi(l); _err != nil {
+			return filter, 0, define.Err(0, "invalid clients history limit", l)
+		}
+	}
+	return filter, limit, nil
+}
+
+// registerServerStatus -> the routes are registered on construction, gin doesn't allow adding them while serving
+// They respond only while the server status is enabled (see statusEnabledMiddleware)
+func (s *Server) registerServerStatus() *Server {
 	// TODO: add authentication details
 	/*
 		TODO: create a group
@@ -166,7 +341,8 @@ func (s *Server) startServerStatus() *Server {
 		awaitStatus := make(chan interface{})
 		// Calling the status function, which returns us a FullStatus Object! This object we afterwards convert to JSON
 
-		exploded := strings.Split(context.Request.RequestURI, "/")
+		// The path doesn't contain the query string
+		exploded := strings.Split(strings.TrimRight(context.Request.URL.Path, "/"), "/")
 
 		switch exploded[len(exploded)-1] {
 		case "server":
@@ -184,11 +360,36 @@ func (s *Server) startServerStatus() *Server {
 				// We have received the status, and we return through channel the response!
 				awaitStatus <- status
 			})
-		case "clients":
-			s.ClientsStatus(func(clientsStatus ClientsStatus) {
+		case "config":
+			s.ConfigStatus(func(status ConfigStatus) {
 				// We have received the status, and we return through channel the response!
-				awaitStatus <- clientsStatus
+				awaitStatus <- status
 			})
+		case "rooms":
+			s.RoomsStatus(func(status RoomsStatus) {
+				// We have received the status, and we return through channel the response!
+				awaitStatus <- status
+			})
+		case "clients":
+			options, _err := clientsPageOptionsFromRequest(context)
+			if _err == nil {
+				var clientsStatus ClientsStatus
+				clientsStatus, _err = s.GetClientsStatus(options)
+				if _err == nil {
+					context.IndentedJSON(http.StatusOK, clientsStatus)
+					return
+				}
+			}
+			context.IndentedJSON(http.StatusBadRequest, gin.H{"error": _err.Error()})
+			return
+		case "history":
+			filter, limit, _err := clientsHistoryFilterFromRequest(context)
+			if _err != nil {
+				context.IndentedJSON(http.StatusBadRequest, gin.H{"error": _err.Error()})
+				return
+			}
+			context.IndentedJSON(http.StatusOK, s.GetClientsHistoryStatus(filter, limit))
+			return
 		default:
 			s.Status(func(status FullStatus) {
 				// We have received the status, and we return through channel the response!
@@ -204,35 +405,95 @@ func (s *Server) startServerStatus() *Server {
 		context.IndentedJSON(200, status)
 	}
 
-	authorized := s.HttpServer.Group("/", gin.BasicAuth(gin.Accounts{
-		s.statusUsername: s.statusPassword,
-	}))
+	readOnly := status_auth.RequireScope(status_auth.ScopeReadOnly)
+	// Clients contain user ids and ip addresses, config contains paths
+	admin := status_auth.RequireScope(status_auth.ScopeAdmin)
 
-	serverStatus := authorized.Group("/server_status")
+	serverStatus := s.getStatusGroup()
 	{
-		serverStatus.GET("/", getStatus)
-		serverStatus.GET("/server", getStatus)
-		serverStatus.GET("/nr_of_clients", getStatus)
-		serverStatus.GET("/system_status", getStatus)
-		serverStatus.GET("/clients", getStatus)
+		serverStatus.GET("/", readOnly, getStatus)
+		serverStatus.GET("/server", readOnly, getStatus)
+		serverStatus.GET("/nr_of_clients", readOnly, getStatus)
+		serverStatus.GET("/system_status", readOnly, getStatus)
+		serverStatus.GET("/rooms", readOnly, getStatus)
+		serverStatus.GET("/clients", admin, getStatus)
+		serverStatus.GET("/clients/history", admin, getStatus)
+		serverStatus.GET("/config", admin, getStatus)
 	}
 	return s
 }
 
 func (s *Server) SetStatusCredentials(username string, password string) *Server {
+	s.statusLock.Lock()
 	s.statusUsername = username
 	s.statusPassword = password
+	s.statusLock.Unlock()
+	return s
+}
+
+// getStatusGroup -> the /server_status group, it's created only once
+// The credentials are checked on each request, in this way they can be rotated at runtime
+func (s *Server) getStatusGroup() *gin.RouterGroup {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+	if s.statusGroup == nil {
+		s.statusGroup = s.HttpServer.Group(
+			"/server_status",
+			s.statusEnabledMiddleware(),
+			status_auth.Middleware(s.getStatusAccounts),
+		)
+	}
+	return s.statusGroup
+}
+
+// AddStatusRoute -> adds a custom GET route under /server_status, protected by the status accounts
+// The route responds only while the server status is enabled
+func (s *Server) AddStatusRoute(relativePath string, scope status_auth.Scope, handler gin.HandlerFunc) *Server {
+	s.getStatusGroup().GET(relativePath, status_auth.RequireScope(scope), handler)
+	return s
+}
+
+// SetStatusAccounts -> sets the additional status accounts (the primary one is set by SetStatusCredentials)
+func (s *Server) SetStatusAccounts(accounts []status_auth.Account) *Server {
+	s.statusLock.Lock()
+	s.statusAccounts = append([]status_auth.Account{}, accounts...)
+	s.statusLock.Unlock()
 	return s
 }
 
+// getStatusAccounts -> the primary account (admin scope) and the additional ones
+func (s *Server) getStatusAccounts() []status_auth.Account {
+	s.statusLock.RLock()
+	defer s.statusLock.RUnlock()
+	accounts := make([]status_auth.Account, 0, len(s.statusAccounts)+1)
+	if s.statusUsername != "" {
+		accounts = append(accounts, status_auth.Account{
+			Username: s.statusUsername,
+			Password: s.statusPassword,
+			Scope:    status_auth.ScopeAdmin,
+		})
+	}
+	return append(accounts, s.statusAccounts...)
+}
+
+// statusEnabledMiddleware -> the routes can't be removed from gin, so when the status is disabled we respond 404
+func (s *Server) statusEnabledMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.enableServerStatus.Get() {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.Next()
+	}
+}
+
 func (s *Server) stopServerStatus() *Server {
-	// TODO: remove from route!
+	// The routes remain registered, but statusEnabledMiddleware will reject the requests
 	return s
 }
 
 func (s *Server) EnableServerStatus() *Server {
 	s.enableServerStatus.Set(true)
-	s.startServerStatus()
 	return s
 }
 
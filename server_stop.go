@@ -33,6 +33,11 @@ func (s *Server) Stop() error {
 		v.(OnStop)(s)
 	})
 
+	// No more listeners are started by AddListener, the running ones are shut down on cancel
+	s.listenersLock.Lock()
+	s.isStarted.Set(false)
+	s.listenersLock.Unlock()
+
 	// Calling Cancel Function! it will send a signal!
 	s.ctx.Cancel()
 
@@ -55,3 +60,7 @@ func (s *Server) IsStopping() bool {
 func (s *Server) IsStopped() bool {
 	return s.isStopped.Get()
 }
+
+func (s *Server) IsStarted() bool {
+	return s.isStarted.Get()
+}
@@ -2,18 +2,24 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/kyaxcorp/go-helper/_context"
 	"github.com/kyaxcorp/go-helper/sync/_bool"
 	"github.com/kyaxcorp/go-helper/sync/_map_string_interface"
+	"github.com/kyaxcorp/go-helper/sync/_string"
 	"github.com/kyaxcorp/go-helper/sync/_time"
 	"github.com/kyaxcorp/go-helper/sync/_uint16"
 	"github.com/kyaxcorp/go-helper/sync/_uint64"
+	"github.com/kyaxcorp/go-http/config"
 	"github.com/kyaxcorp/go-http/middlewares/authentication"
 	"github.com/kyaxcorp/go-http/middlewares/connection"
+	"github.com/kyaxcorp/go-http/middlewares/status_auth"
 	"github.com/kyaxcorp/go-logger/model"
 )
 
@@ -25,6 +31,27 @@ type OnEvent func(...interface{})
 type OnRequest func(c *Client, s *Server)
 type OnResponse func(c *Client, s *Server)
 
+// OnWebSocketMessage -> it's called from the read pump of the client, in the order of the messages
+type OnWebSocketMessage func(c *Client, message []byte, s *Server)
+
+// TextPayloadOnResponse -> it's called when the client responds to a message sent by SendWithResponse
+// err is set if the client hasn't responded in time or it has been disconnected
+type TextPayloadOnResponse func(c *Client, response json.RawMessage, err error)
+
+// OnClientDisconnected -> it's called (in a goroutine) when the client has been disconnected by Disconnect
+type OnClientDisconnected func(c *Client, reason string, s *Server)
+
+// Presence -> they are called when the first connection of the user/device is registered, and when the last one
+// is unregistered (see SetPresenceDebounce), in order, from a single goroutine
+type OnUserOnline func(userID string, s *Server)
+type OnUserOffline func(userID string, s *Server)
+type OnDeviceOnline func(deviceID string, s *Server)
+type OnDeviceOffline func(deviceID string, s *Server)
+
+// OnTokenExpired -> it's called when the auth token of the client has expired, the token can be renewed
+// by Client.RefreshAuthToken, otherwise the client is disconnected after the callbacks
+type OnTokenExpired func(c *Client, s *Server)
+
 // Stop
 type OnStop func(s *Server)
 type OnBeforeStop func(s *Server)
@@ -35,9 +62,16 @@ type OnStart func(s *Server)
 type OnBeforeStart func(s *Server)
 type OnStarted func(s *Server)
 
+// Reload
+type OnBeforeReload func(s *Server, newConfig config.Config)
+type OnReloaded func(s *Server, result ReloadResult)
+type OnReloadFailed func(s *Server, err error)
+
 type Server struct {
-	Name        string
+	Name string
+	// Description -> the one from construction, it can be changed by ApplyConfig (see GetDescription)
 	Description string
+	description *_string.String
 
 	connectionID *_uint64.Uint64
 	// Starting time of the server
@@ -56,12 +90,29 @@ type Server struct {
 	LoggerDirPath string
 	// This is the logger configuration!
 	Logger *model.Logger
+	// logLevel -> the level of the Logger, it can be changed at runtime (see SetLogLevel)
+	logLevel *logLevelSampler
+
+	// config -> it's the running config (with the defaults and generated values), it's used by the live reloads
+	config     config.Config
+	reloadLock sync.Mutex
+
+	// Session limits
+	sessionLimits          config.SessionLimits
+	sessionLimitsOverride  SessionLimitsOverride
+	sessionLimitsLock      sync.RWMutex
+	sessionLimitsCheckLock sync.Mutex
 
 	// Enables Server Status through HTTP
 	enableServerStatus *_bool.Bool
 	// These are the server status credentials
+	statusLock     sync.RWMutex
 	statusUsername string
 	statusPassword string
+	// Additional status accounts with their own scopes
+	statusAccounts []status_auth.Account
+	// The /server_status routes group
+	statusGroup *gin.RouterGroup
 
 	// enableUnsecure -> most of the time is readonly!
 	enableUnsecure bool // Enable unsecure connections
@@ -70,10 +121,16 @@ type Server struct {
 	enableSSL   bool
 	sslCertPath string
 	sslKeyPath  string
+	// The loaded certificate, it can be swapped at runtime
+	certLock    sync.RWMutex
+	certificate *tls.Certificate
 
 	// It also includes port
 	ListeningAddresses    []string // This is for unencrypted
 	ListeningAddressesSSL []string // This is for encrypted
+	// The running http instances, by listenerKey
+	listenersLock sync.Mutex
+	listeners     map[string]*listener
 	// Context
 	parentCtx context.Context
 	ctx       *_context.CancelCtx
@@ -84,6 +141,31 @@ type Server struct {
 	onRequest  *_map_string_interface.MapStringInterface
 	onResponse *_map_string_interface.MapStringInterface
 
+	onClientDisconnected *_map_string_interface.MapStringInterface
+	onWebSocketMessage   *_map_string_interface.MapStringInterface
+
+	onUserOnline    *_map_string_interface.MapStringInterface
+	onUserOffline   *_map_string_interface.MapStringInterface
+	onDeviceOnline  *_map_string_interface.MapStringInterface
+	onDeviceOffline *_map_string_interface.MapStringInterface
+
+	onTokenExpired *_map_string_interface.MapStringInterface
+	// tokenExpiry -> schedules the token expirations of the clients
+	tokenExpiry              *tokenExpiryScheduler
+	disconnectOnTokenExpired *_bool.Bool
+
+	// registry -> it's notified about the local clients, it can answer for the entire cluster
+	registry     ClientsRegistry
+	registryLock sync.RWMutex
+	// registryQueue -> the registry is notified in the background, in the order of the events
+	registryQueue *registryQueue
+
+	// disconnectHistory -> the recently disconnected clients
+	disconnectHistory *disconnectHistory
+
+	// wsUpgrader -> it's used for upgrading the websocket connections
+	wsUpgrader *websocket.Upgrader
+
 	// Stop
 	onStop       *_map_string_interface.MapStringInterface
 	onBeforeStop *_map_string_interface.MapStringInterface
@@ -94,22 +176,25 @@ type Server struct {
 	onBeforeStart *_map_string_interface.MapStringInterface
 	onStarted     *_map_string_interface.MapStringInterface
 
+	// Reload
+	onBeforeReload *_map_string_interface.MapStringInterface
+	onReloaded     *_map_string_interface.MapStringInterface
+	onReloadFailed *_map_string_interface.MapStringInterface
+
 	// Here we store the active/registered ClientsStatus (Connections)
 	c *clientsData
+
+	// traffic -> the totals of all the clients
+	traffic serverTraffic
+
+	// sse -> the broadcast events kept for replay
+	sse *sseHub
 }
 
 // Here we store reverse map of the connections!
 type ClientsIndex struct {
-	// TODO: see later maybe we will use sync.Map for better sync... that's only if register/unregister will perform multiple
-	// Goroutines at once!
-
-	// These are locks for reading/writing to/form indexes
-	usersLock       sync.RWMutex
-	devicesLock     sync.RWMutex
-	connectionsLock sync.RWMutex
-	authTokensLock  sync.RWMutex
-	ipAddressesLock sync.RWMutex
-	requestPathLock sync.RWMutex
+	// The Connections are split by connection ID (clientsShard), the other indexes by hash of the key (keyIndexShard)
+	// A full copy of all of them is returned by Snapshot
 
 	// Indexes
 	Users       map[string]map[uint64]*Client
@@ -118,6 +203,10 @@ type ClientsIndex struct {
 	AuthTokens  map[string]map[uint64]*Client
 	IPAddresses map[string]map[uint64]*Client
 	RequestPath map[string]map[uint64]*Client
+	// Rooms -> the clients which have joined the room (see Client.Join)
+	Rooms map[string]map[uint64]*Client
+	// Custom -> the user-defined indexes (see RegisterClientIndex), by index name
+	Custom map[string]map[string]map[uint64]*Client
 }
 
 type Client struct {
@@ -133,7 +222,9 @@ type Client struct {
 	connectionID uint64
 
 	// Auth Details containing (User Details, Device Details, Authentication Details)
+	// They can be replaced while the request is running, that's why they're read through detailsLock
 	authDetails *authentication.AuthDetails
+	detailsLock sync.RWMutex
 	connDetails *connection.ConnDetails
 
 	// Gin Context
@@ -145,7 +236,17 @@ type Client struct {
 	writeTicker *time.Ticker
 
 	// Buffered channel of outbound messages.
-	send chan []byte
+	// It's created only for the streaming/websocket clients, sendLock protects the channel itself
+	send     chan []byte
+	sendKind sendKind
+	sendLock sync.RWMutex
+	// kind -> it's protected by sendLock, unlike sendKind it's kept when the sending stops
+	kind ClientKind
+
+	// conn -> the websocket connection, it's set only for the websocket clients
+	conn *websocket.Conn
+	// remote -> it's set only for the handles of the clients connected to the other nodes (see ClusterRegistry)
+	remote *ClusterClient
 
 	// It shows if the connection is closed!
 	isClosed *_bool.Bool
@@ -155,6 +256,14 @@ type Client struct {
 	closeCode uint16
 	// closeMessage -> it's mostly read only! it's used only once on graceful disconnect
 	closeMessage string
+	// closeTimer -> forces the disconnect if the client doesn't respond to the close frame
+	closeTimer *time.Timer
+	// disconnectLock -> protects the close code/message/timer and the closers
+	disconnectLock sync.Mutex
+	// closers -> they close the hijacked/streaming connections on Disconnect
+	closers []func() error
+	// cancel -> cancels the request context
+	cancel context.CancelFunc
 
 	// If someone has called disconnect function!
 	isDisconnecting *_bool.Bool
@@ -163,13 +272,31 @@ type Client struct {
 	nrOfSentMessages        *_uint64.Uint64
 	nrOfSentFailedMessages  *_uint64.Uint64
 	nrOfSentSuccessMessages *_uint64.Uint64
+	// nrOfReceivedMessages -> the websocket messages received from the client
+	nrOfReceivedMessages *_uint64.Uint64
+	// nrOfRequests -> the request and the received websocket messages
+	nrOfRequests *_uint64.Uint64
+
+	// Traffic - the bytes of the request/response (or of the websocket messages)
+	bytesIn  *_uint64.Uint64
+	bytesOut *_uint64.Uint64
+	// lastActivity -> the last time when something has been read from/written to the client
+	lastActivity *_time.Time
 
-	/*// Here we store on response callbacks!
-	payloadMessageCallbacks    map[string]TextPayloadOnResponse
-	payloadMessageCallbackLock sync.Mutex*/
+	// Here we store on response callbacks!
+	payloadMessageCallbacks    map[string]*payloadCallback
+	payloadMessageCallbackLock sync.Mutex
 
 	randomPayloadID *_uint16.Uint16
 
+	// rooms -> the rooms joined by the client
+	rooms     map[string]bool
+	roomsLock sync.RWMutex
+
+	// indexedKeys -> the keys under which the client is indexed by the user-defined indexes (by index name)
+	indexedKeys     map[string][]string
+	indexedKeysLock sync.RWMutex
+
 	// This is Custom data array which can be accessed with Get/Set Methods
 	//customData map[string]interface{}
 	customData *_map_string_interface.MapStringInterface
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/kyaxcorp/go-http/middlewares/authentication"
+	"github.com/rs/zerolog"
+)
+
+// tokenExpiryItem -> a client waiting for its token expiration
+type tokenExpiryItem struct {
+	client   *Client
+	expireAt time.Time
+	// index -> the position in the heap
+	index int
+}
+
+// tokenExpiryHeap -> the earliest expiration is on top
+type tokenExpiryHeap []*tokenExpiryItem
+
+func (h tokenExpiryHeap) Len() int {
+	return len(h)
+}
+
+func (h tokenExpiryHeap) Less(i, j int) bool {
+	return h[i].expireAt.Before(h[j].expireAt)
+}
+
+func (h tokenExpiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *tokenExpiryHeap) Push(x interface{}) {
+	item := x.(*tokenExpiryItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *tokenExpiryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*h = old[:n-1]
+	return item
+}
+
+// tokenExpiryScheduler -> a single timer for all the clients, it's set to the earliest expiration
+type tokenExpiryScheduler struct {
+	lock     sync.Mutex
+	items    tokenExpiryHeap
+	byClient map[*Client]*tokenExpiryItem
+	timer    *time.Timer
+	// onExpired -> it's called in a goroutine for each expired client
+	onExpired func(client *Client)
+}
+
+func newTokenExpiryScheduler(onExpired func(client *Client)) *tokenExpiryScheduler {
+	return &tokenExpiryScheduler{
+		byClient:  make(map[*Client]*tokenExpiryItem),
+		onExpired: onExpired,
+	}
+}
+
+// schedule -> sets (or moves) the expiration of the client, a zero time unschedules it
+// The closed clients are not scheduled. The check is done under the lock of unschedule, which is called after
+// the client has been set as closed, so a client closing meanwhile can't remain scheduled
+func (t *tokenExpiryScheduler) schedule(client *Client, expireAt time.Time) {
+	if expireAt.IsZero() {
+		t.unschedule(client)
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if client.isClosed.Get() {
+		return
+	}
+	if item, ok := t.byClient[client]; ok {
+		item.expireAt = expireAt
+		heap.Fix(&t.items, item.index)
+	} else {
+		item = &tokenExpiryItem{client: client, expireAt: expireAt}
+		heap.Push(&t.items, item)
+		t.byClient[client] = item
+	}
+	t.resetTimer()
+}
+
+func (t *tokenExpiryScheduler) unschedule(client *Client) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	item, ok := t.byClient[client]
+	if !ok {
+		return
+	}
+	heap.Remove(&t.items, item.index)
+	delete(t.byClient, client)
+	t.resetTimer()
+}
+
+// len -> the nr. of scheduled clients
+func (t *tokenExpiryScheduler) len() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.items)
+}
+
+// resetTimer -> the programmer should handle locks before!
+func (t *tokenExpiryScheduler) resetTimer() {
+	if len(t.items) == 0 {
+		if t.timer != nil {
+			t.timer.Stop()
+		}
+		return
+	}
+	wait := time.Until(t.items[0].expireAt)
+	if t.timer == nil {
+		t.timer = time.AfterFunc(wait, t.run)
+		return
+	}
+	t.timer.Stop()
+	t.timer.Reset(wait)
+}
+
+// run -> takes out the expired clients, the timer could fire earlier (it's reset meanwhile), that's ok
+func (t *tokenExpiryScheduler) run() {
+	t.lock.Lock()
+	now := time.Now()
+	var expired []*Client
+	for len(t.items) > 0 && !t.items[0].expireAt.After(now) {
+		item := heap.Pop(&t.items).(*tokenExpiryItem)
+		delete(t.byClient, item.client)
+		expired = append(expired, item.client)
+	}
+	t.resetTimer()
+	t.lock.Unlock()
+
+	for _, client := range expired {
+		go t.onExpired(client)
+	}
+}
+
+//-------------------------------------\\
+
+// tokenExpired -> the OnTokenExpired callbacks can refresh the token, otherwise the client is disconnected
+// (if SetDisconnectOnTokenExpired is enabled)
+func (s *Server) tokenExpired(client *Client) {
+	if client.IsDisconnecting() || client.isClosed.Get() {
+		return
+	}
+	info := func() *zerolog.Event {
+		return client.LInfoF("tokenExpired")
+	}
+
+	s.onTokenExpired.Scan(func(k string, v interface{}) {
+		v.(OnTokenExpired)(client, s)
+	})
+
+	expireAt := client.GetTokenExpirationTime()
+	if expireAt.IsZero() || expireAt.After(time.Now()) {
+		info().Time("expire_at", expireAt).Msg("auth token has been refreshed")
+		return
+	}
+	if !s.disconnectOnTokenExpired.Get() {
+		return
+	}
+	info().Msg("auth token has expired, disconnecting...")
+	_ = client.Disconnect(TokenExpiredReason)
+}
+
+// setClientAuthDetails -> re-indexes the client, schedules its token expiration and updates the registry
+func (s *Server) setClientAuthDetails(client *Client, details *authentication.AuthDetails) {
+	s.c.updateClientAuthDetails(client, details)
+	s.tokenExpiry.schedule(client, client.GetTokenExpirationTime())
+	// If it finishes meanwhile, the queued update is skipped (see publishRegistryEvent)
+	s.registryRegister(client)
+}
+
+// SetDisconnectOnTokenExpired -> if disabled, the OnTokenExpired callbacks are only notified
+// It's enabled by default
+func (s *Server) SetDisconnectOnTokenExpired(disconnect bool) *Server {
+	s.disconnectOnTokenExpired.Set(disconnect)
+	return s
+}
+
+// RefreshAuthToken -> replaces the token details of the client (ex: from an OnTokenExpired callback),
+// the session continues with the new expiration
+func (c *Client) RefreshAuthToken(tokenDetails authentication.AuthTokenDetails) {
+	details := *c.GetAuthDetails()
+	details.AuthTokenDetails = tokenDetails
+	if c.server == nil {
+		c.setAuthDetails(&details)
+		return
+	}
+	c.server.setClientAuthDetails(c, &details)
+}
+
+// GetNrOfScheduledTokenExpirations -> the nr. of clients with an expiring token
+func (s *Server) GetNrOfScheduledTokenExpirations() int {
+	return s.tokenExpiry.len()
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestTokenExpiryScheduleWhileClosing -> run it with -race, the auth details are set while the client
+// is closing, no client should remain scheduled
+func TestTokenExpiryScheduleWhileClosing(t *testing.T) {
+	s := newTestServer(t)
+	const nrOfClients = 500
+
+	var wg sync.WaitGroup
+	for i := 0; i < nrOfClients; i++ {
+		client := newIndexedClient(uint64(i + 1))
+		details := *client.GetAuthDetails()
+		details.AuthTokenDetails.ExpireDate = time.Now().Add(time.Hour)
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s.setClientAuthDetails(client, &details)
+		}()
+		go func() {
+			defer wg.Done()
+			// Same order as when the request finishes
+			client.setAsClosed()
+			s.tokenExpiry.unschedule(client)
+		}()
+	}
+	wg.Wait()
+
+	if nrOfScheduled := s.GetNrOfScheduledTokenExpirations(); nrOfScheduled != 0 {
+		t.Errorf("%d closed clients remained scheduled", nrOfScheduled)
+	}
+}
+
+// TestTokenExpiryScheduleClosed -> once closed (and unscheduled), the client can't be scheduled again
+func TestTokenExpiryScheduleClosed(t *testing.T) {
+	scheduler := newTokenExpiryScheduler(func(client *Client) {})
+	client := newIndexedClient(1)
+	scheduler.schedule(client, time.Now().Add(time.Hour))
+	if scheduler.len() != 1 {
+		t.Fatalf("expected the client to be scheduled, got %d", scheduler.len())
+	}
+
+	client.setAsClosed()
+	scheduler.unschedule(client)
+	scheduler.schedule(client, time.Now().Add(time.Hour))
+	if scheduler.len() != 0 {
+		t.Errorf("the closed client has been scheduled")
+	}
+}
@@ -0,0 +1,356 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/kyaxcorp/go-helper/errors2/define"
+	"github.com/rs/zerolog"
+)
+
+// ClientKind -> how the client is connected
+type ClientKind string
+
+const (
+	// ClientKindRequest -> a plain http request
+	ClientKindRequest   ClientKind = "request"
+	ClientKindSSE       ClientKind = "sse"
+	ClientKindWebSocket ClientKind = "websocket"
+	// ClientKindHijacked -> the connection has been taken over by the handler
+	ClientKindHijacked ClientKind = "hijacked"
+)
+
+// sendKind -> the kind of the messages which are queued for the client
+type sendKind uint8
+
+const (
+	sendKindNone sendKind = iota
+	sendKindSSE
+	sendKindWebSocket
+)
+
+// WebSocketPayload -> the message sent by SendWithResponse
+// The client should respond with {"response_to": "<id>", "data": ...}
+type WebSocketPayload struct {
+	ID         string          `json:"id,omitempty"`
+	ResponseTo string          `json:"response_to,omitempty"`
+	Data       json.RawMessage `json:"data,omitempty"`
+}
+
+type payloadCallback struct {
+	callback TextPayloadOnResponse
+	timer    *time.Timer
+}
+
+// SetWebSocketCheckOrigin -> by default, only the requests from the same origin are upgraded
+// It should be called before starting the server
+func (s *Server) SetWebSocketCheckOrigin(checkOrigin func(r *http.Request) bool) *Server {
+	s.wsUpgrader.CheckOrigin = checkOrigin
+	return s
+}
+
+// WebSocket -> registers a GET route which upgrades the request to a websocket connection
+// The handlers are called before the upgrade, they can be used for authentication
+func (s *Server) WebSocket(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return s.HttpServer.GET(relativePath, append(handlers, s.WebSocketHandler())...)
+}
+
+// WebSocketHandler -> upgrades the request and runs the read/write pumps of the client, until the
+// connection is closed or the client is disconnected
+// The received messages are passed to the OnWebSocketMessage callbacks
+func (s *Server) WebSocketHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client := GetClientFromCtx(c)
+		if client == nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		info := func() *zerolog.Event {
+			return client.LInfoF("WebSocketHandler")
+		}
+		_error := func() *zerolog.Event {
+			return client.LErrorF("WebSocketHandler")
+		}
+
+		// On failure, the upgrader has already responded
+		conn, _err := s.wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+		if _err != nil {
+			_error().Err(_err).Msg("failed to upgrade the connection")
+			return
+		}
+		defer conn.Close()
+		defer client.stopCloseTimer()
+
+		client.sendLock.Lock()
+		client.conn = conn
+		client.sendLock.Unlock()
+
+		send := client.startSending(sendKindWebSocket, DefaultWebSocketSendBufferSize)
+		defer client.stopSending()
+		defer client.failPayloadCallbacks(define.Err(0, "client disconnected"))
+
+		info().Msg("connected...")
+		defer info().Msg("disconnected")
+
+		writeDone := make(chan struct{})
+		readDone := make(chan struct{})
+		go func() {
+			defer close(writeDone)
+			client.writePump(conn, send, readDone)
+		}()
+		client.readPump(conn)
+		close(readDone)
+		<-writeDone
+	}
+}
+
+// readPump -> reads the messages until the connection is closed
+func (c *Client) readPump(conn *websocket.Conn) {
+	conn.SetReadLimit(DefaultWebSocketMaxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(DefaultWebSocketPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(DefaultWebSocketPongWait))
+	})
+
+	for {
+		_, message, _err := conn.ReadMessage()
+		if _err != nil {
+			// On graceful disconnect, the client responds with our close code
+			expectedCodes := []int{websocket.CloseNormalClosure, websocket.CloseGoingAway}
+			if closeCode := c.GetCloseCode(); closeCode != 0 {
+				expectedCodes = append(expectedCodes, int(closeCode))
+			}
+			if websocket.IsUnexpectedCloseError(_err, expectedCodes...) {
+				c.LWarnF("readPump").Err(_err).Msg("connection closed unexpectedly")
+			}
+			return
+		}
+		c.messageReceived(len(message))
+		if c.handlePayloadResponse(message) {
+			continue
+		}
+		c.server.onWebSocketMessage.Scan(func(k string, v interface{}) {
+			v.(OnWebSocketMessage)(c, message, c.server)
+		})
+	}
+}
+
+// writePump -> it's the only one writing the messages, it also pings the client
+func (c *Client) writePump(conn *websocket.Conn, send chan []byte, readDone chan struct{}) {
+	c.writeTicker = time.NewTicker(DefaultWebSocketPingPeriod)
+	defer c.writeTicker.Stop()
+
+	for {
+		select {
+		case <-readDone:
+			return
+		case <-c.httpContext.Request.Context().Done():
+			return
+		case message := <-send:
+			_ = conn.SetWriteDeadline(time.Now().Add(DefaultWebSocketWriteWait))
+			if _err := conn.WriteMessage(websocket.TextMessage, message); _err != nil {
+				c.messageFailed()
+				// The read pump will fail too
+				_ = conn.Close()
+				return
+			}
+			c.messageSent()
+			c.addBytesOut(len(message))
+		case <-c.writeTicker.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(DefaultWebSocketWriteWait))
+			if _err := conn.WriteMessage(websocket.PingMessage, nil); _err != nil {
+				_ = conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// Send -> queues the message for the websocket client, for a remote client it is routed to its node
+func (c *Client) Send(message []byte) error {
+	if c.remote != nil {
+		return c.server.GetClientsRegistry().Send(*c.remote, message)
+	}
+	if !c.enqueue(sendKindWebSocket, message) {
+		return define.Err(0, "message not queued, the client is not a websocket client or its queue is full")
+	}
+	return nil
+}
+
+// SendJSON -> same as Send, but the message is encoded to json
+func (c *Client) SendJSON(message interface{}) error {
+	encoded, _err := json.Marshal(message)
+	if _err != nil {
+		return _err
+	}
+	return c.Send(encoded)
+}
+
+// SendWithResponse -> sends the payload with a generated ID, the callback is called when the client
+// responds with the same ID, or with an error on timeout/disconnect
+func (c *Client) SendWithResponse(payload interface{}, callback TextPayloadOnResponse) error {
+	data, _err := json.Marshal(payload)
+	if _err != nil {
+		return _err
+	}
+	id := c.genPayloadID()
+	message, _err := json.Marshal(WebSocketPayload{
+		ID:   id,
+		Data: data,
+	})
+	if _err != nil {
+		return _err
+	}
+
+	pc := &payloadCallback{callback: callback}
+	c.payloadMessageCallbackLock.Lock()
+	if c.payloadMessageCallbacks == nil {
+		c.payloadMessageCallbacks = make(map[string]*payloadCallback)
+	}
+	c.payloadMessageCallbacks[id] = pc
+	pc.timer = time.AfterFunc(DefaultWebSocketResponseTimeout, func() {
+		if pc := c.takePayloadCallback(id); pc != nil {
+			pc.callback(c, nil, define.Err(0, "response timeout", id))
+		}
+	})
+	c.payloadMessageCallbackLock.Unlock()
+
+	if _err = c.Send(message); _err != nil {
+		if pc := c.takePayloadCallback(id); pc != nil {
+			pc.timer.Stop()
+		}
+		return _err
+	}
+	return nil
+}
+
+// takePayloadCallback -> removes the callback, nil if it's missing (already called)
+func (c *Client) takePayloadCallback(id string) *payloadCallback {
+	c.payloadMessageCallbackLock.Lock()
+	defer c.payloadMessageCallbackLock.Unlock()
+	pc, ok := c.payloadMessageCallbacks[id]
+	if !ok {
+		return nil
+	}
+	delete(c.payloadMessageCallbacks, id)
+	return pc
+}
+
+// handlePayloadResponse -> if the message is a response to SendWithResponse, the callback is called
+func (c *Client) handlePayloadResponse(message []byte) bool {
+	c.payloadMessageCallbackLock.Lock()
+	waiting := len(c.payloadMessageCallbacks) > 0
+	c.payloadMessageCallbackLock.Unlock()
+	if !waiting {
+		return false
+	}
+
+	var payload WebSocketPayload
+	if json.Unmarshal(message, &payload) != nil || payload.ResponseTo == "" {
+		return false
+	}
+	pc := c.takePayloadCallback(payload.ResponseTo)
+	if pc == nil {
+		return false
+	}
+	pc.timer.Stop()
+	pc.callback(c, payload.Data, nil)
+	return true
+}
+
+// failPayloadCallbacks -> calls the waiting callbacks with the error
+func (c *Client) failPayloadCallbacks(_err error) {
+	c.payloadMessageCallbackLock.Lock()
+	callbacks := c.payloadMessageCallbacks
+	c.payloadMessageCallbacks = nil
+	c.payloadMessageCallbackLock.Unlock()
+	for _, pc := range callbacks {
+		pc.timer.Stop()
+		pc.callback(c, nil, _err)
+	}
+}
+
+// DisconnectGracefully -> sends the close frame to the websocket client, set 0 and "" for default values!
+// The connection is closed when the client responds, or forcefully after DefaultWebSocketWriteWait
+func (c *Client) DisconnectGracefully(code uint16, message string) error {
+	if code == 0 {
+		code = DefaultCloseCode
+	}
+	if message == "" {
+		message = DefaultCloseReason
+	}
+
+	c.sendLock.RLock()
+	conn := c.conn
+	c.sendLock.RUnlock()
+	if conn == nil {
+		// It's not a websocket client
+		return c.Disconnect(message)
+	}
+
+	// The message is kept as the disconnect reason, the client usually closes the connection by itself
+	c.disconnectLock.Lock()
+	c.closeCode = code
+	c.closeMessage = message
+	c.disconnectLock.Unlock()
+
+	_err := conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(int(code), message),
+		time.Now().Add(DefaultWebSocketWriteWait),
+	)
+	if _err != nil {
+		return c.Disconnect(message)
+	}
+	closeTimer := time.AfterFunc(DefaultWebSocketWriteWait, func() {
+		if c.isClosed.Get() {
+			return
+		}
+		_ = c.Disconnect(message)
+	})
+	c.disconnectLock.Lock()
+	if c.closeTimer != nil {
+		c.closeTimer.Stop()
+	}
+	c.closeTimer = closeTimer
+	c.disconnectLock.Unlock()
+	return nil
+}
+
+// stopCloseTimer -> the connection has been closed, there is nothing to force
+func (c *Client) stopCloseTimer() {
+	c.disconnectLock.Lock()
+	defer c.disconnectLock.Unlock()
+	if c.closeTimer != nil {
+		c.closeTimer.Stop()
+	}
+}
+
+// GetCloseCode -> the code given to DisconnectGracefully
+func (c *Client) GetCloseCode() uint16 {
+	c.disconnectLock.Lock()
+	defer c.disconnectLock.Unlock()
+	return c.closeCode
+}
+
+// SendTo -> queues the message for the websocket clients found by the filter, the messages for the clients
+// of the other nodes are routed to their nodes (when a ClusterRegistry is set)
+// It returns the nr. of clients to which the message has been queued or routed
+func (s *Server) SendTo(filter FindClientsFilter, message []byte) int {
+	nrOfQueued := 0
+	for _, client := range s.GetClientsByFilter(filter) {
+		if client.IsRemote() {
+			if client.GetKind() == ClientKindWebSocket && client.Send(message) == nil {
+				nrOfQueued++
+			}
+			continue
+		}
+		if client.enqueue(sendKindWebSocket, message) {
+			nrOfQueued++
+		}
+	}
+	return nrOfQueued
+}
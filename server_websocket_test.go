@@ -0,0 +1,115 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// waitFor -> polls the condition until it's true or the timeout has passed
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestDisconnectGracefully -> the client closes the connection after the close frame, the history has the close code
+// and message, the forced disconnect is not called anymore
+func TestDisconnectGracefully(t *testing.T) {
+	s := newTestServer(t)
+	s.WebSocket("/ws")
+	server := httptest.NewServer(s.HttpServer)
+	defer server.Close()
+
+	conn, _, _err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if _err != nil {
+		t.Fatal(_err)
+	}
+	defer conn.Close()
+
+	var client *Client
+	waitFor(t, func() bool {
+		for c := range s.GetClients() {
+			if c.GetKind() == ClientKindWebSocket {
+				client = c
+			}
+		}
+		return client != nil
+	})
+
+	if _err = client.DisconnectGracefully(4000, "going to sleep"); _err != nil {
+		t.Fatal(_err)
+	}
+	// The close frame is answered by the default close handler
+	_, _, _err = conn.ReadMessage()
+	if !websocket.IsCloseError(_err, 4000) {
+		t.Fatalf("expected the close frame, got %v", _err)
+	}
+	waitFor(t, func() bool {
+		return len(s.RecentDisconnects(FindClientsFilter{All: true})) == 1
+	})
+
+	entry := s.RecentDisconnects(FindClientsFilter{All: true})[0]
+	if entry.CloseCode != 4000 || entry.DisconnectReason != "going to sleep" {
+		t.Errorf("expected the close code and message in the history, got %d %q", entry.CloseCode, entry.DisconnectReason)
+	}
+	client.disconnectLock.Lock()
+	pending := client.closeTimer.Stop()
+	client.disconnectLock.Unlock()
+	if pending {
+		t.Error("the forced disconnect is still scheduled after the connection has been closed")
+	}
+	if client.IsDisconnecting() {
+		t.Error("the client has been disconnected after closing the connection")
+	}
+}
+
+// TestClientNrOfRequests -> the upgrade request and each received message are counted for the client,
+// the server counts only the http requests
+func TestClientNrOfRequests(t *testing.T) {
+	s := newTestServer(t)
+	s.WebSocket("/ws")
+	server := httptest.NewServer(s.HttpServer)
+	defer server.Close()
+
+	conn, _, _err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if _err != nil {
+		t.Fatal(_err)
+	}
+	defer conn.Close()
+	for i := 0; i < 3; i++ {
+		if _err = conn.WriteMessage(websocket.TextMessage, []byte("hello")); _err != nil {
+			t.Fatal(_err)
+		}
+	}
+
+	var client *Client
+	waitFor(t, func() bool {
+		for c := range s.GetClients() {
+			if c.GetNrOfReceivedMessages() == 3 {
+				client = c
+			}
+		}
+		return client != nil
+	})
+	if details := newClientDetails(client); details.NrOfRequests != 4 {
+		t.Errorf("expected 4 requests for the client, got %d", details.NrOfRequests)
+	}
+	if nrOfRequests := s.GetTrafficStatus().NrOfRequests; nrOfRequests != 1 {
+		t.Errorf("expected 1 request for the server, got %d", nrOfRequests)
+	}
+
+	// The handler should finish before the next test
+	_ = conn.Close()
+	waitFor(t, func() bool {
+		return s.GetNrOfClients() == 0
+	})
+}